@@ -64,6 +64,82 @@ func NewApp() *cli.App {
 							return nil
 						},
 					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write results to a file instead of printing them. The format is inferred from the extension: .parquet, .csv, .ndjson, .arrow",
+					},
+				},
+			},
+			{
+				Name:      "export",
+				Aliases:   []string{"e"},
+				Usage:     "Export models or query results to Parquet, CSV, NDJSON or Arrow files",
+				ArgsUsage: "[model names...]",
+				Action:    Export,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Output file, or directory when exporting multiple models or partitioning",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Set export format. Options are 'parquet', 'csv', 'ndjson', 'arrow'. Inferred from the output extension by default",
+						Action: func(c *cli.Context, v string) error {
+							if v != "parquet" && v != "csv" && v != "ndjson" && v != "arrow" {
+								return fmt.Errorf("invalid format: %s. Allowed values are 'parquet', 'csv', 'ndjson', 'arrow'", v)
+							}
+							return nil
+						},
+					},
+					&cli.StringFlag{
+						Name:    "query",
+						Aliases: []string{"q"},
+						Usage:   "Export the results of a query instead of model tables",
+					},
+					&cli.StringSliceFlag{
+						Name:    "partition-by",
+						Aliases: []string{"p"},
+						Usage:   "Partition the output by column, e.g. preen_source_name",
+					},
+				},
+			},
+			{
+				Name:   "serve",
+				Usage:  "Serve the built models to external clients",
+				Action: Serve,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "pg",
+						Usage: "Serve the models over the Postgres wire protocol, for psql and BI tools",
+					},
+					&cli.StringFlag{
+						Name:  "pg-addr",
+						Usage: "Address the Postgres wire protocol server listens on",
+						Value: "127.0.0.1:5433",
+					},
+					&cli.StringFlag{
+						Name:    "pg-password",
+						Usage:   "Password Postgres wire protocol clients authenticate with. Required to listen on a non-loopback address",
+						EnvVars: []string{"PREEN_PG_PASSWORD"},
+					},
+					&cli.BoolFlag{
+						Name:  "http",
+						Usage: "Serve the HTTP API for running queries, describing models and triggering builds",
+					},
+					&cli.StringFlag{
+						Name:  "http-addr",
+						Usage: "Address the HTTP API listens on",
+						Value: "127.0.0.1:8080",
+					},
+					&cli.StringFlag{
+						Name:    "http-token",
+						Usage:   "Bearer token HTTP API clients authenticate with. Required to listen on a non-loopback address",
+						EnvVars: []string{"PREEN_HTTP_TOKEN"},
+					},
 				},
 			},
 			{
@@ -80,17 +156,34 @@ func NewApp() *cli.App {
 							&cli.StringFlag{
 								Name:    "target",
 								Aliases: []string{"t"},
-								Usage:   "Target a specific model(s). The default is all models. This is relative to the PREEN_MODELS_PATH.",
+								Usage:   "Target a specific model(s). The default is all models. This is relative to the PREEN_MODELS_PATH. Use +model to include upstream models and model+ to include downstream models.",
 							},
 							&cli.BoolFlag{
 								Name:    "source-name",
 								Aliases: []string{"sn"},
 								Usage:   "Target a specific source",
 							},
+							&cli.BoolFlag{
+								Name:  "full-refresh",
+								Usage: "Rebuild incremental models from scratch, ignoring stored cursors",
+							},
 						},
 					},
 				},
 			},
+			{
+				Name:    "test",
+				Aliases: []string{"tst"},
+				Usage:   "Run data quality tests against built models",
+				Action:  TestModels,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "target",
+						Aliases: []string{"t"},
+						Usage:   "Target a specific model(s). The default is all models. This is relative to the PREEN_MODELS_PATH.",
+					},
+				},
+			},
 			{
 				Name:    "source",
 				Aliases: []string{"s"},
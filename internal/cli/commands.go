@@ -6,6 +6,7 @@ import (
 
 	"github.com/preendata/preen/internal/engine"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
 )
 
 func Query(c *cli.Context) error {
@@ -14,18 +15,31 @@ func Query(c *cli.Context) error {
 	stmt := c.Args().First()
 	engine.Debug("Query: ", stmt)
 
-	qr, err := engine.Execute(stmt)
+	// Write results to a file instead of printing them
+	if output := c.String("output"); output != "" {
+		exportFormat, err := engine.GetExportFormat(output)
+		if err != nil {
+			return err
+		}
+		if err = engine.ExportQuery(stmt, engine.ExportOptions{Format: exportFormat, Path: output}); err != nil {
+			return fmt.Errorf("error exporting query %w", err)
+		}
+		return nil
+	}
+
+	qs, err := engine.StreamQuery(stmt)
 
 	if err != nil {
 		engine.Debug("error executing query", err)
 		return fmt.Errorf("error executing query %w", err)
 	}
+	defer qs.Close()
 	if format == "json" {
-		if err := engine.PrintPrettyJSON(qr.Rows); err != nil {
+		if err := engine.PrintJSONStream(qs); err != nil {
 			return fmt.Errorf("error pretty printing JSON: %w", err)
 		}
 	} else {
-		if err := engine.WriteToTable(qr.Rows, qr.Columns, "table"); err != nil {
+		if err := engine.WriteQueryStream(qs, "table"); err != nil {
 			return fmt.Errorf("error writing to table: %w", err)
 		}
 	}
@@ -33,6 +47,39 @@ func Query(c *cli.Context) error {
 	return nil
 }
 
+func Export(c *cli.Context) error {
+	engine.Debug("Executing cli.export")
+	output := c.String("output")
+	opts := engine.ExportOptions{
+		Format:      c.String("format"),
+		Path:        output,
+		PartitionBy: c.StringSlice("partition-by"),
+	}
+	if opts.Format == "" {
+		exportFormat, err := engine.GetExportFormat(output)
+		if err != nil {
+			return err
+		}
+		opts.Format = exportFormat
+	}
+
+	if stmt := c.String("query"); stmt != "" {
+		if err := engine.ExportQuery(stmt, opts); err != nil {
+			return fmt.Errorf("error exporting query %w", err)
+		}
+		return nil
+	}
+
+	if c.NArg() == 0 {
+		return fmt.Errorf("no models to export. Pass model names as arguments or a query with --query")
+	}
+	if err := engine.ExportModels(c.Args().Slice(), opts); err != nil {
+		return fmt.Errorf("error exporting models %w", err)
+	}
+
+	return nil
+}
+
 func BuildModel(c *cli.Context) error {
 	engine.Debug("Executing cli.buildmodel")
 	modelTarget := c.String("target")
@@ -40,6 +87,7 @@ func BuildModel(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("error getting config %w", err)
 	}
+	mc.FullRefresh = c.Bool("full-refresh")
 
 	err = engine.BuildModels(sc, mc)
 	if err != nil {
@@ -49,6 +97,49 @@ func BuildModel(c *cli.Context) error {
 	return nil
 }
 
+func TestModels(c *cli.Context) error {
+	engine.Debug("Executing cli.testmodels")
+	modelTarget := c.String("target")
+	sc, mc, err := engine.GetConfig(modelTarget)
+	if err != nil {
+		return fmt.Errorf("error getting config %w", err)
+	}
+
+	if err = engine.RunModelTests(sc, mc); err != nil {
+		return fmt.Errorf("error testing models %w", err)
+	}
+
+	return nil
+}
+
+func Serve(c *cli.Context) error {
+	engine.Debug("Executing cli.serve")
+	if !c.Bool("pg") && !c.Bool("http") {
+		return fmt.Errorf("no server to start. Pass --pg, --http or both")
+	}
+
+	// The servers run until one of them fails
+	serverErrGroup := new(errgroup.Group)
+	if c.Bool("pg") {
+		serverErrGroup.Go(func() error {
+			if err := engine.ServePostgres(c.String("pg-addr"), c.String("pg-password")); err != nil {
+				return fmt.Errorf("error serving postgres wire protocol %w", err)
+			}
+			return nil
+		})
+	}
+	if c.Bool("http") {
+		serverErrGroup.Go(func() error {
+			if err := engine.ServeHTTPAPI(c.String("http-addr"), c.String("http-token")); err != nil {
+				return fmt.Errorf("error serving http api %w", err)
+			}
+			return nil
+		})
+	}
+
+	return serverErrGroup.Wait()
+}
+
 func BuildMetadata(c *cli.Context) error {
 	engine.Debug("Executing cli.buildInformationSchema")
 	modelTarget := ""
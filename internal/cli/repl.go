@@ -64,13 +64,15 @@ func Repl(c *cli.Context) error {
 		}
 
 		// Execute the input as a query
-		qr, err := engine.Execute(cmd)
+		qs, err := engine.StreamQuery(cmd)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
 		}
 
-		if err := engine.WriteToTable(qr.Rows, qr.Columns, outputFormat); err != nil {
+		err = engine.WriteQueryStream(qs, outputFormat)
+		qs.Close()
+		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
 		}
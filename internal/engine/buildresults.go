@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceResult records the outcome of retrieving a single model from a single source.
+type SourceResult struct {
+	ModelName     string
+	SourceName    string
+	RowsRetrieved int64
+	Duration      time.Duration
+	Err           error
+}
+
+// BuildResults collects the source results of a model build so they can be
+// printed and stored in the preen_build_results table once the build finishes.
+type BuildResults struct {
+	StartedAt time.Time
+	Results   []SourceResult
+	mu        sync.Mutex
+}
+
+func newBuildResults() *BuildResults {
+	return &BuildResults{StartedAt: time.Now()}
+}
+
+func (br *BuildResults) add(result SourceResult) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.Results = append(br.Results, result)
+}
+
+// failures returns the failed source results for a model.
+func (br *BuildResults) failures(modelName string) []SourceResult {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	failed := make([]SourceResult, 0)
+	for _, result := range br.Results {
+		if result.ModelName == modelName && result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// report prints the build summary and stores it in duckDB.
+func (br *BuildResults) report() {
+	if len(br.Results) == 0 {
+		return
+	}
+	if err := br.print(); err != nil {
+		Errorf("Error printing build results: %s", err)
+	}
+	if err := br.store(); err != nil {
+		Errorf("Error storing build results: %s", err)
+	}
+}
+
+func (br *BuildResults) print() error {
+	columns := []string{"model_name", "source_name", "rows_retrieved", "duration", "status", "error"}
+	rows := make([]map[string]any, len(br.Results))
+	for i, result := range br.Results {
+		rows[i] = map[string]any{
+			"model_name":     result.ModelName,
+			"source_name":    result.SourceName,
+			"rows_retrieved": result.RowsRetrieved,
+			"duration":       result.Duration.Round(time.Millisecond).String(),
+			"status":         result.status(),
+			"error":          result.errorString(),
+		}
+	}
+	return WriteToTable(rows, columns, "table")
+}
+
+// store appends the build results to the preen_build_results table, creating it if not exists.
+func (br *BuildResults) store() error {
+	columnNames := []string{
+		"build_started_at timestamp",
+		"model_name varchar",
+		"source_name varchar",
+		"rows_retrieved bigint",
+		"duration_ms bigint",
+		"status varchar",
+		"error varchar",
+	}
+	err := ddbExec(fmt.Sprintf("create table if not exists main.preen_build_results (%s)", strings.Join(columnNames, ", ")))
+	if err != nil {
+		return err
+	}
+
+	ic := make(chan []driver.Value, 10)
+	dc := make(chan insertResult)
+	go Insert("preen_build_results", ic, dc)
+	for _, result := range br.Results {
+		ic <- []driver.Value{
+			br.StartedAt,
+			result.ModelName,
+			result.SourceName,
+			result.RowsRetrieved,
+			result.Duration.Milliseconds(),
+			result.status(),
+			result.errorString(),
+		}
+	}
+	ic <- []driver.Value{"quit"}
+	ConfirmInsert("preen_build_results", dc, int64(len(br.Results)))
+
+	return nil
+}
+
+func (r SourceResult) status() string {
+	if r.Err != nil {
+		return "failed"
+	}
+	return "success"
+}
+
+func (r SourceResult) errorString() string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	return ""
+}
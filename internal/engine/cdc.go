@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/preendata/sqlparser"
+)
+
+// CDC configures a database model to be built from the changes captured by its sources instead of
+// re-running its query. The first build snapshots the table and stores the source's replication
+// position, later builds apply the inserts, updates and deletes committed since the previous build.
+// Postgres sources read the changes from a logical replication slot, mysql sources from the binlog.
+// PrimaryKey refers to columns of the model table, i.e. the aliases in the model query.
+// Slot and Publication (postgres) and ServerID (mysql) default to values derived from the model and source names.
+type CDC struct {
+	PrimaryKey  []string `yaml:"primary_key"`
+	Slot        string   `yaml:"slot"`
+	Publication string   `yaml:"publication"`
+	ServerID    uint32   `yaml:"server_id"`
+	// The replicated table and the table column of every model column, set when the model is parsed.
+	// The schema is empty unless the query qualifies the table.
+	schema  string
+	table   string
+	columns []string
+	aliases []string
+}
+
+// tableSchema returns the schema of the replicated table, or the engine's default schema.
+func (c *CDC) tableSchema(defaultSchema string) string {
+	if c.schema == "" {
+		return defaultSchema
+	}
+	return c.schema
+}
+
+// cdcProgress carries a source's stored replication position into its retrieval, and the
+// changes that could not be streamed into the staging table out of it.
+type cdcProgress struct {
+	config *CDC
+	// DuckDB model table, read for the values of unchanged columns
+	tableName   string
+	slot        string
+	publication string
+	serverID    uint32
+	// Position stored by the previous build. Empty if the table has to be snapshotted
+	position string
+	// Position stored once the changes are merged
+	endPosition string
+	// The source's rows are replaced by the staged rows, after a snapshot or a truncate
+	replace bool
+	// Rows holding the primary key of every deleted row
+	deletes [][]driver.Value
+}
+
+var cdcNameRegex = regexp.MustCompile(`[^a-z0-9_]`)
+
+// validateCDC checks that a CDC model selects plain columns of a single table, so the replicated
+// rows of that table can be mapped onto the model table.
+func validateCDC(model *Model) error {
+	cdc := model.CDC
+	if cdc == nil {
+		return nil
+	}
+	if model.Incremental != nil {
+		return fmt.Errorf("cdc and incremental can not be combined")
+	}
+	if len(cdc.PrimaryKey) == 0 {
+		return fmt.Errorf("primary_key required")
+	}
+	selectStmt, ok := model.Parsed.(*sqlparser.Select)
+	if !ok {
+		return fmt.Errorf("non-select queries not supported")
+	}
+	if selectStmt.Where != nil || selectStmt.GroupBy != nil || selectStmt.Having != nil || selectStmt.Distinct != "" || selectStmt.Limit != nil {
+		return fmt.Errorf("cdc models can not filter, group or limit rows")
+	}
+	if len(selectStmt.From) != 1 {
+		return fmt.Errorf("cdc models must select from a single table")
+	}
+	tableExpr, ok := selectStmt.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return fmt.Errorf("cdc models must select from a single table")
+	}
+	tableName, ok := tableExpr.Expr.(sqlparser.TableName)
+	if !ok {
+		return fmt.Errorf("cdc models must select from a table")
+	}
+	cdc.table = tableName.Name.String()
+	cdc.schema = tableName.Qualifier.String()
+
+	cdc.columns = make([]string, 0, len(selectStmt.SelectExprs))
+	for _, selectExpr := range selectStmt.SelectExprs {
+		expr, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return fmt.Errorf("cdc models must select columns explicitly")
+		}
+		colName, ok := expr.Expr.(*sqlparser.ColName)
+		if !ok {
+			return fmt.Errorf("cdc models can only select table columns, found %s", sqlparser.String(expr.Expr))
+		}
+		cdc.columns = append(cdc.columns, colName.Name.String())
+	}
+	cdc.aliases = getSelectAliases(selectStmt)
+	for _, key := range cdc.PrimaryKey {
+		if !slices.Contains(cdc.aliases, key) {
+			return fmt.Errorf("primary_key column %s is not selected by the model query", key)
+		}
+	}
+	return nil
+}
+
+// cdcDefaultName derives a valid postgres slot or publication name. Slot names are unique across
+// the whole postgres cluster, so slots include the source name.
+func cdcDefaultName(parts ...string) string {
+	name := cdcNameRegex.ReplaceAllString(strings.ToLower("preen_"+strings.Join(parts, "_")), "_")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// cdcDefaultServerID derives the server id preen uses to read a mysql binlog. Server ids must be unique
+// across the mysql servers and replicas reading the binlog, the high bit keeps it clear of the small
+// ids servers are usually configured with.
+func cdcDefaultServerID(parts ...string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return h.Sum32() | 1<<31
+}
+
+func newCDCProgress(model *Model, source Source, tableName string, position string) *cdcProgress {
+	progress := &cdcProgress{
+		config:      model.CDC,
+		tableName:   tableName,
+		slot:        model.CDC.Slot,
+		publication: model.CDC.Publication,
+		serverID:    model.CDC.ServerID,
+		position:    position,
+	}
+	if progress.slot == "" {
+		progress.slot = cdcDefaultName(string(model.Name), source.Name)
+	}
+	if progress.publication == "" {
+		progress.publication = cdcDefaultName(string(model.Name))
+	}
+	if progress.serverID == 0 {
+		progress.serverID = cdcDefaultServerID(string(model.Name), source.Name)
+	}
+	return progress
+}
+
+// cdcDeletesTableName is the table that receives the keys of deleted rows before they are merged.
+func cdcDeletesTableName(tableName string) string {
+	return tableName + "_preen_deletes"
+}
+
+// buildCDCTables creates the model, staging and cursor tables like an incremental model, and the
+// table for deleted keys. The replication position of every source is stored as its cursor.
+func buildCDCTables(model *Model, fullRefresh bool) error {
+	if err := buildIncrementalTables(model, fullRefresh); err != nil {
+		return err
+	}
+	tableName := modelTableName(model.Name)
+	createDeletesStmt := fmt.Sprintf("create or replace table main.%s (%s);", cdcDeletesTableName(tableName), model.DDLString)
+	if err := ddbExec(createDeletesStmt); err != nil {
+		return fmt.Errorf("error creating deletes table for %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// cdcChange is the latest state of a row changed since the previous build.
+type cdcChange struct {
+	row     []driver.Value
+	deleted bool
+}
+
+// cdcChanges folds the changes captured from a source into the latest state of every changed row.
+// Rows are model table rows, starting with the source name.
+type cdcChanges struct {
+	r          *Retriever
+	keyIndexes []int
+	pending    map[string]cdcChange
+	keys       []string
+	// Model table connection and statement reading the previous state of rows, opened by the first
+	// update with unchanged values and reused for every later one
+	db           *sql.DB
+	previousStmt *sql.Stmt
+}
+
+func newCDCChanges(r *Retriever) *cdcChanges {
+	c := &cdcChanges{
+		r:       r,
+		pending: make(map[string]cdcChange),
+	}
+	for _, key := range r.CDC.config.PrimaryKey {
+		// Rows start with the source name
+		c.keyIndexes = append(c.keyIndexes, slices.Index(r.CDC.config.aliases, key)+1)
+	}
+	return c
+}
+
+// update replaces the row with the key row's key. Values at the unchanged positions were not sent by
+// the source and are taken from the row's previous state.
+func (c *cdcChanges) update(keyRow []driver.Value, row []driver.Value, unchanged []int) error {
+	if len(unchanged) > 0 {
+		previous, err := c.previousRow(keyRow)
+		if err != nil {
+			return err
+		}
+		for _, i := range unchanged {
+			if previous != nil {
+				row[i] = previous[i]
+			}
+		}
+	}
+	if c.key(keyRow) != c.key(row) {
+		c.set(keyRow, true)
+	}
+	c.set(row, false)
+	return nil
+}
+
+// previousRow returns the state of the row with the key row's key from earlier in this build, or from the model table.
+func (c *cdcChanges) previousRow(row []driver.Value) ([]driver.Value, error) {
+	if change, ok := c.pending[c.key(row)]; ok {
+		if change.deleted {
+			return nil, nil
+		}
+		return change.row, nil
+	}
+
+	if c.previousStmt == nil {
+		if err := c.preparePreviousRow(); err != nil {
+			return nil, fmt.Errorf("error reading unchanged values: %w", err)
+		}
+	}
+	args := []any{c.r.Source.Name}
+	for _, keyIndex := range c.keyIndexes {
+		args = append(args, row[keyIndex])
+	}
+	previous := make([]driver.Value, len(row))
+	scanArgs := make([]any, len(c.r.CDC.config.aliases))
+	for i := range scanArgs {
+		scanArgs[i] = &previous[i+1]
+	}
+	err := c.previousStmt.QueryRow(args...).Scan(scanArgs...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading unchanged values: %w", err)
+	}
+	return previous, nil
+}
+
+// preparePreviousRow opens the DuckDB connection previousRow reads the model table with. Opening DuckDB
+// loads its extensions, so the connection is kept until close instead of being opened for every row.
+func (c *cdcChanges) preparePreviousRow() error {
+	connector, err := ddbCreateConnector()
+	if err != nil {
+		return err
+	}
+	db, err := ddbOpenDatabase(connector)
+	if err != nil {
+		return err
+	}
+	conditions := []string{"preen_source_name = $1"}
+	for i, key := range c.r.CDC.config.PrimaryKey {
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", key, i+2))
+	}
+	query := fmt.Sprintf(
+		"select %s from main.%s where %s",
+		strings.Join(c.r.CDC.config.aliases, ", "), c.r.CDC.tableName, strings.Join(conditions, " and "),
+	)
+	Debug("preparing duckdb query: ", query)
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	c.db, c.previousStmt = db, stmt
+	return nil
+}
+
+// close releases the connection used to read the previous state of rows.
+func (c *cdcChanges) close() {
+	if c.previousStmt != nil {
+		c.previousStmt.Close()
+		c.previousStmt = nil
+	}
+	if c.db != nil {
+		c.db.Close()
+		c.db = nil
+	}
+}
+
+func (c *cdcChanges) key(row []driver.Value) string {
+	parts := make([]string, len(c.keyIndexes))
+	for i, keyIndex := range c.keyIndexes {
+		parts[i] = fmt.Sprint(row[keyIndex])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (c *cdcChanges) set(row []driver.Value, deleted bool) {
+	key := c.key(row)
+	if _, ok := c.pending[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.pending[key] = cdcChange{row: row, deleted: deleted}
+}
+
+// truncate drops the changes captured so far. Every row of the source is replaced by the rows inserted after the truncate.
+func (c *cdcChanges) truncate() {
+	c.pending = make(map[string]cdcChange)
+	c.keys = nil
+	c.r.CDC.replace = true
+}
+
+// flush sends the latest state of every inserted or updated row to the staging table.
+func (c *cdcChanges) flush(ic chan []driver.Value) {
+	upserts := 0
+	for _, key := range c.keys {
+		change := c.pending[key]
+		if change.deleted {
+			c.r.CDC.deletes = append(c.r.CDC.deletes, change.row)
+			continue
+		}
+		ic <- change.row
+		upserts++
+	}
+	Debug(fmt.Sprintf("Captured %d upserts and %d deletes for %s - %s", upserts, len(c.r.CDC.deletes), c.r.Source.Name, c.r.ModelName))
+}
+
+// mergeCDCModel applies the staged rows and deleted keys of every source that succeeded to the
+// model table, and stores the sources' new replication positions in the same transaction.
+func mergeCDCModel(model *Model, tableName string, progress map[string]*cdcProgress) error {
+	stagingTable := stagingTableName(tableName)
+	deletesTable := cdcDeletesTableName(tableName)
+
+	deletes := make([][]driver.Value, 0)
+	replaced := make([]string, 0)
+	for sourceName, sourceProgress := range progress {
+		deletes = append(deletes, sourceProgress.deletes...)
+		if sourceProgress.replace {
+			replaced = append(replaced, fmt.Sprintf("'%s'", strings.ReplaceAll(sourceName, "'", "''")))
+		}
+	}
+	if len(deletes) > 0 {
+		ic := make(chan []driver.Value, 10000)
+		dc := make(chan insertResult)
+		go Insert(ModelName(deletesTable), ic, dc)
+		for _, row := range deletes {
+			ic <- row
+		}
+		ic <- []driver.Value{"quit"}
+		ConfirmInsert(deletesTable, dc, 0)
+	}
+
+	// Rows are unique per source, so the source name is always part of the key.
+	conditions := []string{fmt.Sprintf("main.%s.preen_source_name = s.preen_source_name", tableName)}
+	for _, key := range model.CDC.PrimaryKey {
+		conditions = append(conditions, fmt.Sprintf("main.%s.%s = s.%s", tableName, key, key))
+	}
+	queries := []string{"begin transaction"}
+	if len(replaced) > 0 {
+		queries = append(queries, fmt.Sprintf("delete from main.%s where preen_source_name in (%s)", tableName, strings.Join(replaced, ", ")))
+	}
+	queries = append(queries,
+		fmt.Sprintf("delete from main.%s using main.%s as s where %s", tableName, stagingTable, strings.Join(conditions, " and ")),
+		fmt.Sprintf("delete from main.%s using main.%s as s where %s", tableName, deletesTable, strings.Join(conditions, " and ")),
+		fmt.Sprintf("insert into main.%s select * from main.%s", tableName, stagingTable),
+		fmt.Sprintf("drop table main.%s", stagingTable),
+		fmt.Sprintf("drop table main.%s", deletesTable),
+	)
+	for sourceName, sourceProgress := range progress {
+		sourceName = strings.ReplaceAll(sourceName, "'", "''")
+		queries = append(queries,
+			fmt.Sprintf("delete from %s where model_name = '%s' and source_name = '%s'", incrementalCursorsTable, model.Name, sourceName),
+			fmt.Sprintf(
+				"insert into %s (model_name, source_name, cursor_value, updated_at) values ('%s', '%s', '%s', now())",
+				incrementalCursorsTable, model.Name, sourceName, sourceProgress.endPosition,
+			),
+		)
+	}
+	queries = append(queries, "commit")
+
+	Debug(fmt.Sprintf("Merging changes into cdc model %s", model.Name))
+	if err := ddbExec(strings.Join(queries, ";\n")); err != nil {
+		return fmt.Errorf("error merging cdc model %s: %w", model.Name, err)
+	}
+	return nil
+}
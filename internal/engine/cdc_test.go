@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/preendata/sqlparser"
+)
+
+func TestValidateCDC(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		cdc         *CDC
+		expectError bool
+	}{
+		{"valid", "select id, name as customer_name from customers", &CDC{PrimaryKey: []string{"id"}}, false},
+		{"schema qualified", "select id from sales.customers", &CDC{PrimaryKey: []string{"id"}}, false},
+		{"missing primary key", "select id from customers", &CDC{}, true},
+		{"primary key not selected", "select name from customers", &CDC{PrimaryKey: []string{"id"}}, true},
+		{"filtered", "select id from customers where id > 10", &CDC{PrimaryKey: []string{"id"}}, true},
+		{"join", "select c.id from customers c join orders o on c.id = o.customer_id", &CDC{PrimaryKey: []string{"id"}}, true},
+		{"expression", "select id, upper(name) as name from customers", &CDC{PrimaryKey: []string{"id"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := sqlparser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = validateCDC(&Model{Parsed: stmt, CDC: tt.cdc})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCDCDefaultName(t *testing.T) {
+	if name := cdcDefaultName("customer-orders", "Prod DB"); name != "preen_customer_orders_prod_db" {
+		t.Errorf("cdcDefaultName() = %s; want preen_customer_orders_prod_db", name)
+	}
+	long := "a_very_long_model_name_that_does_not_fit_into_a_postgres_identifier"
+	if name := cdcDefaultName(long); len(name) != 63 {
+		t.Errorf("cdcDefaultName() has %d characters; want 63", len(name))
+	}
+	if cdcDefaultServerID("orders", "shard-1") == cdcDefaultServerID("orders", "shard-2") {
+		t.Errorf("cdcDefaultServerID() is the same for different sources")
+	}
+}
@@ -0,0 +1,362 @@
+package engine
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+)
+
+// clickhouseDefaultPort and clickhouseDefaultTLSPort are the ports of ClickHouse's HTTP interface.
+const (
+	clickhouseDefaultPort    = 8123
+	clickhouseDefaultTLSPort = 8443
+)
+
+// clickhouseEngine queries ClickHouse over its HTTP interface. Results are read in the
+// JSONCompactEachRowWithNamesAndTypes format, so every value is converted by its column's ClickHouse type.
+type clickhouseEngine struct {
+	source   Source
+	client   *http.Client
+	endpoint string
+}
+
+func init() {
+	RegisterSourceEngine("clickhouse", newClickhouseEngine)
+}
+
+func newClickhouseEngine(source Source) SourceEngine {
+	return &clickhouseEngine{source: source}
+}
+
+// clickhouseEndpoint builds the url of the HTTP interface, or reads it from the source's uri. Timestamps
+// are returned as ISO 8601 in UTC. Credentials in a uri are sent with basic authentication.
+func clickhouseEndpoint(source Source) (string, error) {
+	if source.Connection.URI != "" {
+		u, err := url.Parse(source.Connection.URI)
+		if err != nil {
+			return "", fmt.Errorf("invalid clickhouse uri: %w", err)
+		}
+		query := u.Query()
+		query.Set("date_time_output_format", "iso")
+		u.RawQuery = query.Encode()
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		return u.String(), nil
+	}
+	scheme := "http"
+	port := source.Connection.Port
+	if mode := tlsMode(source); mode != "" && mode != "disable" {
+		scheme = "https"
+		if port == 0 {
+			port = clickhouseDefaultTLSPort
+		}
+	}
+	if port == 0 {
+		port = clickhouseDefaultPort
+	}
+	// Options are ClickHouse settings, e.g. max_execution_time
+	query := connectionOptions(source)
+	if source.Connection.Database != "" {
+		query.Set("database", source.Connection.Database)
+	}
+	query.Set("date_time_output_format", "iso")
+	u := &url.URL{
+		Scheme:   scheme,
+		Host:     fmt.Sprintf("%s:%d", source.Connection.Host, port),
+		Path:     "/",
+		RawQuery: query.Encode(),
+	}
+	return u.String(), nil
+}
+
+func (e *clickhouseEngine) Connect() error {
+	tlsConf, err := tlsConfig(e.source)
+	if err != nil {
+		return err
+	}
+	e.client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConf}}
+	if e.endpoint, err = clickhouseEndpoint(e.source); err != nil {
+		return err
+	}
+	body, err := e.post("select 1")
+	if err != nil {
+		return fmt.Errorf("unable to connect to clickhouse: %w", err)
+	}
+	return body.Close()
+}
+
+// post sends a query and returns the response body, which the caller must close.
+func (e *clickhouseEngine) post(query string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	if e.source.Connection.Username != "" {
+		req.Header.Set("X-ClickHouse-User", e.source.Connection.Username)
+		req.Header.Set("X-ClickHouse-Key", e.source.Connection.Password)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("clickhouse returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// DescribeColumns queries system.columns for the tables used by a SQL model.
+// Qualified tables are looked up in the database they are qualified with, unqualified tables in the current database.
+func (e *clickhouseEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	if model.Type != "database" || model.Parsed == nil || len(model.TableSet) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf(`
+		select database, table, name, type, currentDatabase() from system.columns
+		where %s
+	`, tableSetCondition(model.TableSet, "database", "table", "currentDatabase()"))
+
+	return e.queryRows(query, func(columns []clickhouseColumn, row []any) error {
+		values := make([]string, len(row))
+		for i, value := range row {
+			values[i], _ = value.(string)
+		}
+		for _, tableName := range tableSetNames(model.TableSet, values[0], values[1], values[4]) {
+			ic <- []driver.Value{e.source.Name, string(model.Name), string(tableName), values[2], clickhouseColumnType(values[3])}
+		}
+		return nil
+	})
+}
+
+// Stream retrieves data from a ClickHouse source and sends it to the insert channel.
+func (e *clickhouseEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	var rowCounter int64
+	err := e.queryRows(r.Query, func(columns []clickhouseColumn, row []any) error {
+		rowCounter++
+		driverRow := make([]driver.Value, len(row)+1)
+		driverRow[0] = r.Source.Name
+		for i, value := range row {
+			var err error
+			if driverRow[i+1], err = clickhouseDriverValue(value, columns[i].duckdbType); err != nil {
+				return fmt.Errorf("error converting column %s: %w", columns[i].name, err)
+			}
+		}
+		ic <- driverRow
+		return nil
+	})
+	Debug(fmt.Sprintf("Retrieved %d rows for %s - %s\n", rowCounter, r.Source.Name, r.ModelName))
+	return err
+}
+
+func (e *clickhouseEngine) Query(query string) ([]map[string]any, error) {
+	results := make([]map[string]any, 0)
+	err := e.queryRows(query, func(columns []clickhouseColumn, row []any) error {
+		result := make(map[string]any, len(row))
+		for i, value := range row {
+			converted, err := clickhouseDriverValue(value, columns[i].duckdbType)
+			if err != nil {
+				return err
+			}
+			result[columns[i].name] = converted
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+func (e *clickhouseEngine) Close() error {
+	if e.client != nil {
+		e.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+type clickhouseColumn struct {
+	name       string
+	duckdbType string
+}
+
+// queryRows runs a query and calls fn with each row, as decoded from JSON.
+func (e *clickhouseEngine) queryRows(query string, fn func(columns []clickhouseColumn, row []any) error) error {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	body, err := e.post(query + "\nformat JSONCompactEachRowWithNamesAndTypes")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return readClickhouseRows(body, fn)
+}
+
+// readClickhouseRows reads the JSONCompactEachRowWithNamesAndTypes format: an array of column names,
+// an array of column types and an array of values per row.
+func readClickhouseRows(r io.Reader, fn func(columns []clickhouseColumn, row []any) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	decoder.UseNumber()
+	var names, types []string
+	if err := decoder.Decode(&names); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("error reading clickhouse column names: %w", err)
+	}
+	if err := decoder.Decode(&types); err != nil || len(types) != len(names) {
+		return fmt.Errorf("error reading clickhouse column types: %v", err)
+	}
+	columns := make([]clickhouseColumn, len(names))
+	for i := range names {
+		columns[i] = clickhouseColumn{name: names[i], duckdbType: duckdbTypeMap[clickhouseColumnType(types[i])]}
+	}
+	for {
+		var row []any
+		if err := decoder.Decode(&row); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// Errors after the response started are written into the body
+			return fmt.Errorf("error reading clickhouse rows: %w", err)
+		}
+		if len(row) != len(columns) {
+			return fmt.Errorf("clickhouse returned %d values for %d columns", len(row), len(columns))
+		}
+		if err := fn(columns, row); err != nil {
+			return err
+		}
+	}
+}
+
+// clickhouseColumnType maps a ClickHouse type to its duckdbTypeMap type. Nullable and LowCardinality
+// are unwrapped, arrays, maps and tuples are stored as json. Types without a DuckDB equivalent, e.g.
+// Int128 or IPv6, are stored as varchar.
+func clickhouseColumnType(dataType string) string {
+	for _, wrapper := range []string{"Nullable(", "LowCardinality("} {
+		if strings.HasPrefix(dataType, wrapper) && strings.HasSuffix(dataType, ")") {
+			return clickhouseColumnType(dataType[len(wrapper) : len(dataType)-1])
+		}
+	}
+	// Strip the parameters, e.g. DateTime64(3, 'UTC') or Decimal(18, 4)
+	name := dataType
+	if i := strings.Index(name, "("); i != -1 {
+		name = name[:i]
+	}
+	switch name {
+	case "Int8":
+		return "tinyint"
+	case "Int16", "UInt8":
+		return "smallint"
+	case "Int32", "UInt16":
+		return "integer"
+	case "Int64", "UInt32":
+		return "bigint"
+	case "UInt64":
+		return "ubigint"
+	case "Float32":
+		return "real"
+	case "Float64":
+		return "double"
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		return "decimal"
+	case "Bool":
+		return "boolean"
+	case "Date", "Date32":
+		return "date"
+	case "DateTime", "DateTime64":
+		return "timestamp"
+	case "UUID":
+		return "uuid"
+	case "Array", "Map", "Tuple", "Nested", "JSON", "Object":
+		return "json"
+	default:
+		return "varchar"
+	}
+}
+
+// clickhouseDriverValue converts a value decoded from JSON to the go type the DuckDB appender expects.
+// 64 bit integers are quoted by ClickHouse, so numbers are parsed from strings as well.
+func clickhouseDriverValue(value any, duckdbType string) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch duckdbType {
+	case "tinyint", "smallint", "integer", "bigint":
+		bits := map[string]int{"tinyint": 8, "smallint": 16, "integer": 32, "bigint": 64}[duckdbType]
+		i, err := strconv.ParseInt(clickhouseNumber(value), 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch duckdbType {
+		case "tinyint":
+			return int8(i), nil
+		case "smallint":
+			return int16(i), nil
+		case "integer":
+			return int32(i), nil
+		default:
+			return i, nil
+		}
+	case "ubigint":
+		return strconv.ParseUint(clickhouseNumber(value), 10, 64)
+	case "real":
+		f, err := strconv.ParseFloat(clickhouseNumber(value), 32)
+		return float32(f), err
+	case "double":
+		return strconv.ParseFloat(clickhouseNumber(value), 64)
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "date":
+		if s, ok := value.(string); ok {
+			return time.Parse(time.DateOnly, s)
+		}
+	case "timestamp":
+		if s, ok := value.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	case "uuid":
+		if s, ok := value.(string); ok {
+			b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+			if err != nil || len(b) != 16 {
+				return nil, fmt.Errorf("invalid uuid %s", s)
+			}
+			return duckdb.UUID(b), nil
+		}
+	case "json":
+		b, err := json.Marshal(value)
+		return string(b), err
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		b, err := json.Marshal(value)
+		return string(b), err
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, duckdbType)
+}
+
+// clickhouseNumber returns the text of a number, which is a json.Number or a quoted string.
+func clickhouseNumber(value any) string {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
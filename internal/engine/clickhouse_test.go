@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+)
+
+func TestClickhouseColumnType(t *testing.T) {
+	tests := []struct {
+		dataType string
+		expected string
+	}{
+		{"UInt8", "smallint"},
+		{"Int64", "bigint"},
+		{"UInt64", "ubigint"},
+		{"Nullable(Float64)", "double"},
+		{"Decimal(18, 4)", "double"},
+		{"LowCardinality(Nullable(String))", "varchar"},
+		{"FixedString(16)", "varchar"},
+		{"Enum8('click' = 1, 'view' = 2)", "varchar"},
+		{"DateTime64(3, 'Europe/Berlin')", "timestamp"},
+		{"Nullable(DateTime)", "timestamp"},
+		{"Date32", "date"},
+		{"Array(Nullable(String))", "json"},
+		{"Map(String, UInt64)", "json"},
+		{"UUID", "uuid"},
+		{"Int128", "varchar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dataType, func(t *testing.T) {
+			if result := duckdbTypeMap[clickhouseColumnType(tt.dataType)]; result != tt.expected {
+				t.Errorf("clickhouseColumnType() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClickhouseDriverValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       any
+		duckdbType  string
+		expected    driver.Value
+		expectError bool
+	}{
+		{"int8", json.Number("-8"), "tinyint", int8(-8), false},
+		{"int32", json.Number("42"), "integer", int32(42), false},
+		{"quoted int64", "9007199254740993", "bigint", int64(9007199254740993), false},
+		{"uint64", "18446744073709551615", "ubigint", uint64(18446744073709551615), false},
+		{"overflow", json.Number("300"), "tinyint", nil, true},
+		{"float64", json.Number("1.5"), "double", 1.5, false},
+		{"date", "2024-03-05", "date", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), false},
+		{"datetime64", "2024-03-05T10:20:30.123Z", "timestamp", time.Date(2024, 3, 5, 10, 20, 30, 123000000, time.UTC), false},
+		{"uuid", "01234567-89ab-cdef-0102-030405060708", "uuid", duckdb.UUID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 1, 2, 3, 4, 5, 6, 7, 8}, false},
+		{"array", []any{"a", nil, json.Number("1")}, "json", `["a",null,1]`, false},
+		{"string", "click", "varchar", "click", false},
+		{"null", nil, "bigint", nil, false},
+		{"invalid boolean", "yes", "boolean", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := clickhouseDriverValue(tt.value, tt.duckdbType)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("clickhouseDriverValue() = %#v; want %#v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClickhouseEngine(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query, _ := io.ReadAll(req.Body)
+		if req.Header.Get("X-ClickHouse-User") != "preen" || req.URL.Query().Get("database") != "events" {
+			http.Error(w, "Code: 516. DB::Exception: Authentication failed", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case string(query) == "select 1":
+			io.WriteString(w, "1\n")
+		case strings.HasPrefix(string(query), "select id, kind, tags from clicks\nformat "):
+			io.WriteString(w, `["id","kind","tags"]
+["UInt64","LowCardinality(String)","Array(String)"]
+["1","view",["a","b"]]
+["18446744073709551615","click",[]]
+`)
+		default:
+			http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	source := Source{Name: "events", Engine: "clickhouse", Connection: Connection{Host: u.Hostname(), Port: port, Database: "events", Username: "preen"}}
+
+	e := newClickhouseEngine(source)
+	if err := e.Connect(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.Close()
+
+	ic := make(chan []driver.Value, 10)
+	if err := e.Stream(&Retriever{Source: source, ModelName: "clicks", Query: "select id, kind, tags from clicks;"}, ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(ic)
+	rows := make([][]driver.Value, 0)
+	for row := range ic {
+		rows = append(rows, row)
+	}
+	expected := [][]driver.Value{
+		{"events", uint64(1), "view", `["a","b"]`},
+		{"events", uint64(18446744073709551615), "click", "[]"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Stream() = %v; want %v", rows, expected)
+	}
+
+	if err := e.Stream(&Retriever{Source: source, Query: "selec 1"}, make(chan []driver.Value, 1)); err == nil || !strings.Contains(err.Error(), "Syntax error") {
+		t.Errorf("expected syntax error, got %v", err)
+	}
+	source.Connection.Username = "guest"
+	if err := newClickhouseEngine(source).Connect(); err == nil {
+		t.Errorf("expected authentication error, got nil")
+	}
+}
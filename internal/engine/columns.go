@@ -3,6 +3,7 @@ package engine
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/preendata/sqlparser"
@@ -23,6 +24,7 @@ type columnParser struct {
 	columns        map[TableName]map[ColumnName]Column
 	ddlString      string
 	tableName      TableName
+	tableMap       TableMap
 	modelName      ModelName
 	selectIdx      int
 	columnMetadata ColumnMetadata
@@ -175,6 +177,8 @@ func ParseModelColumns(mc *ModelConfig, columnMetadata ColumnMetadata) error {
 			}
 		case "file":
 			Debug("no columns to parse for file model")
+		case "transform":
+			Debug("no columns to parse for transform model")
 		default:
 			return fmt.Errorf("model type %s not supported", model.Type)
 		}
@@ -187,6 +191,7 @@ func ParseModelColumns(mc *ModelConfig, columnMetadata ColumnMetadata) error {
 
 func parseSQLDatabaseModelColumns(model *Model, cp *columnParser) error {
 	cp.ddlString = "preen_source_name varchar"
+	cp.tableMap = model.TableMap
 	selectStmt := model.Parsed.(*sqlparser.Select)
 	for selectIdx := range selectStmt.SelectExprs {
 		cp.selectIdx = selectIdx
@@ -230,7 +235,6 @@ func parseSQLDatabaseModelColumns(model *Model, cp *columnParser) error {
 func parseNoSQLDatabaseModelColumns(model *Model, cp *columnParser) error {
 	cp.modelName = ModelName(model.Name)
 	cp.tableName = TableName(model.Name)
-	cp.ddlString = "preen_source_name varchar, document json"
 	cp.columns[cp.tableName] = make(map[ColumnName]Column)
 	sourceColumn := Column{
 		ModelName: model.Name,
@@ -241,6 +245,43 @@ func parseNoSQLDatabaseModelColumns(model *Model, cp *columnParser) error {
 	}
 	sourceColumnHashKey := ColumnName(fmt.Sprintf("%s.preen_source_name", model.Name))
 	cp.columns[cp.tableName][sourceColumnHashKey] = sourceColumn
+
+	// Models without declared fields get a column for every top-level field of the sampled documents
+	if len(model.Fields) == 0 {
+		model.Fields = sampledDocumentFields(cp.columnMetadata[cp.tableName])
+	}
+	// Fields become typed columns. If no documents were sampled, the whole document is stored as json
+	if len(model.Fields) > 0 {
+		cp.ddlString = "preen_source_name varchar"
+		for idx := range model.Fields {
+			field := &model.Fields[idx]
+			// Fields without a declared type use the majority BSON type of the sampled documents
+			if field.Type == "" {
+				bsonType, ok := cp.columnMetadata[cp.tableName][ColumnName(field.Path)]
+				if !ok {
+					return fmt.Errorf("field %s.%s not found in the sampled documents. declare its type", model.Name, field.Name)
+				}
+				field.Type = bsonDuckdbTypeMap[string(bsonType.MajorityType)]
+			}
+			fieldColumn := Column{
+				ModelName: model.Name,
+				TableName: &cp.tableName,
+				IsJoin:    false,
+				Position:  idx + 1,
+				Alias:     field.Name,
+			}
+			fieldColumnHashKey := ColumnName(fmt.Sprintf("%s.%s", model.Name, field.Name))
+			cp.columns[cp.tableName][fieldColumnHashKey] = fieldColumn
+			colType := duckdbTypeMap[strings.ToLower(field.Type)]
+			if colType == "" {
+				return fmt.Errorf("data type not found for field: %s.%s", model.Name, field.Name)
+			}
+			cp.ddlString = fmt.Sprintf("%s, \"%s\" %s", cp.ddlString, field.Name, colType)
+		}
+		return nil
+	}
+
+	cp.ddlString = "preen_source_name varchar, document json"
 	documentColumn := Column{
 		ModelName: model.Name,
 		TableName: &cp.tableName,
@@ -254,6 +295,25 @@ func parseNoSQLDatabaseModelColumns(model *Model, cp *columnParser) error {
 	return nil
 }
 
+// sampledDocumentFields returns an untyped field for every top-level field path of a document model's
+// sampled documents, sorted by name. Their types are resolved like those of declared fields without a type.
+func sampledDocumentFields(columns map[ColumnName]ColumnType) []DocumentField {
+	fields := make([]DocumentField, 0, len(columns))
+	for columnName := range columns {
+		path := string(columnName)
+		// Keys with dots can not be looked up by path, and preen_source_name is taken
+		if strings.Contains(path, ".") || path == "preen_source_name" {
+			Warn(fmt.Sprintf("Skipping document field %s, it can not be stored as a column", path))
+			continue
+		}
+		fields = append(fields, DocumentField{Name: path, Path: path})
+	}
+	slices.SortFunc(fields, func(a, b DocumentField) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return fields
+}
+
 func processModelColumn(expr *sqlparser.AliasedExpr, cp *columnParser) error {
 	// We require fully qualified column names, i.e. table.column, users.user_id.
 	if expr.Expr.(*sqlparser.ColName).Qualifier.Name.String() == "" {
@@ -325,9 +385,9 @@ func processFunction(expr *sqlparser.AliasedExpr, cp *columnParser) error {
 	default:
 		selectExpr := funcExpr.Exprs[0].(*sqlparser.AliasedExpr).Expr
 		colName := selectExpr.(*sqlparser.ColName).Name.String()
-		tableName := TableName(selectExpr.(*sqlparser.ColName).Qualifier.Name.String())
+		tableName := cp.tableMap[TableAlias(selectExpr.(*sqlparser.ColName).Qualifier.Name.String())]
 		if _, ok := cp.columnMetadata[tableName][ColumnName(colName)]; !ok {
-			return fmt.Errorf("column not found in table: %s.%s. check that your model query is valid", cp.tableName, colName)
+			return fmt.Errorf("column not found in table: %s.%s. check that your model query is valid", tableName, colName)
 		}
 		colType := duckdbTypeMap[string(cp.columnMetadata[tableName][ColumnName(colName)].MajorityType)]
 		cp.ddlString = fmt.Sprintf("%s, %s %s", cp.ddlString, col.Alias, colType)
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"fmt"
 
+	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/marcboeker/go-duckdb"
 )
 
@@ -23,7 +25,7 @@ func ddbNewAppender(connector driver.Connector, schema string, table string) (*d
 	return appender, nil
 }
 
-func ddbCreateConnector() (driver.Connector, error) {
+func ddbCreateConnector() (*duckdb.Connector, error) {
 	connector, err := duckdb.NewConnector("./preenContext.db?threads=4", func(execer driver.ExecerContext) error {
 		bootQueries := []string{
 			"INSTALL 'json'",
@@ -75,64 +77,105 @@ func ddbExec(queryString string) error {
 	return err
 }
 
-func ddbQuery(queryString string, c chan map[string]any) ([]string, error) {
+// ddbExecWithSetup runs a setup statement and then a query on the same connection. The setup statement
+// is not logged, since it can hold credentials, e.g. the create secret statement of an s3 source.
+func ddbExecWithSetup(setup string, queryString string) error {
 	connector, err := ddbCreateConnector()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	db, err := ddbOpenDatabase(connector)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
 	defer db.Close()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(context.Background(), setup); err != nil {
+		return fmt.Errorf("error running setup statement: %w", err)
+	}
 	Debug("querying duckdb database with query: ", queryString)
-	rows, err := db.Query(queryString)
+	_, err = conn.ExecContext(context.Background(), queryString)
+	return err
+}
+
+// ddbQuery runs a query and returns its unread rows. The caller closes both the rows and the database.
+func ddbQuery(queryString string, args ...any) (*sql.DB, *sql.Rows, error) {
+	connector, err := ddbCreateConnector()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	columns, err := rows.Columns()
+
+	db, err := ddbOpenDatabase(connector)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	err = ReadRows(rows, c)
+	Debug("querying duckdb database with query: ", queryString)
+	rows, err := db.Query(queryString, args...)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, rows, nil
+}
 
+// ddbQueryArrow runs a query through DuckDB's Arrow interface and passes the record batch reader to fn.
+func ddbQueryArrow(queryString string, fn func(reader array.RecordReader) error) error {
+	connector, err := ddbCreateConnector()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer connector.Close()
+	conn, err := connector.Connect(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ddbArrow, err := duckdb.NewArrowFromConn(conn)
+	if err != nil {
+		return err
 	}
-	return columns, err
+	Debug("querying duckdb database through arrow with query: ", queryString)
+	reader, err := ddbArrow.QueryContext(context.Background(), queryString)
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	return fn(reader)
 }
 
-func ReadRows(rows *sql.Rows, c chan map[string]any) error {
+// collectRows reads all rows of a database/sql result set into memory.
+func collectRows(rows *sql.Rows) ([]map[string]any, error) {
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	numColumns := len(columns)
-
-	values := make([]any, numColumns)
+	values := make([]any, len(columns))
+	scanArgs := make([]any, len(columns))
 	for i := range values {
-		values[i] = new(interface{})
+		scanArgs[i] = &values[i]
 	}
 
+	results := make([]map[string]any, 0)
 	for rows.Next() {
-		if err := rows.Scan(values...); err != nil {
-			return err
+		if err = rows.Scan(scanArgs...); err != nil {
+			return nil, err
 		}
-
-		dest := make(map[string]interface{}, numColumns)
+		row := make(map[string]any, len(columns))
 		for i, column := range columns {
-			dest[column] = *(values[i].(*interface{}))
+			row[column] = values[i]
 		}
-		c <- dest
-	}
-
-	if err := rows.Err(); err != nil {
-		return err
+		results = append(results, row)
 	}
-	return nil
+	return results, rows.Err()
 }
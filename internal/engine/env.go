@@ -52,13 +52,7 @@ func _fromEnv(rv reflect.Value) {
 		if fv.Kind() == reflect.Slice {
 			for j := 0; j < fv.Len(); j++ {
 				if fv.Index(j).Kind() == reflect.String {
-					match := envRegex.FindStringSubmatch(fv.Index(j).String())
-					if len(match) > 1 {
-						slog.Debug(
-							fmt.Sprintf("Setting env var: '%s'", match[1]),
-						)
-						fv.SetString(os.Getenv(match[1]))
-					}
+					fv.Index(j).SetString(expandEnvString(fv.Index(j).String()))
 				}
 				if fv.Index(j).Kind() == reflect.Struct {
 					_fromEnv(fv.Index(j))
@@ -66,18 +60,30 @@ func _fromEnv(rv reflect.Value) {
 				}
 			}
 		}
-		if fv.Kind() == reflect.String {
-			match := envRegex.FindStringSubmatch(fv.String())
-			if len(match) > 1 {
-				slog.Debug(
-					fmt.Sprintf("Setting env var: '%s'", match[1]),
-				)
-				fv.SetString(os.Getenv(match[1]))
+		if fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.String {
+			iter := fv.MapRange()
+			for iter.Next() {
+				fv.SetMapIndex(iter.Key(), reflect.ValueOf(expandEnvString(iter.Value().String())))
 			}
 		}
+		if fv.Kind() == reflect.String {
+			fv.SetString(expandEnvString(fv.String()))
+		}
 	}
 }
 
+// expandEnvString replaces every ${VAR} placeholder in s with the environment variable's value,
+// e.g. the credentials embedded in a connection uri.
+func expandEnvString(s string) string {
+	return envRegex.ReplaceAllStringFunc(s, func(match string) string {
+		name := envRegex.FindStringSubmatch(match)[1]
+		slog.Debug(
+			fmt.Sprintf("Setting env var: '%s'", name),
+		)
+		return os.Getenv(name)
+	})
+}
+
 func getEnv[T float64 | string | int | bool | time.Duration](key string, defaultVal T, required bool) T {
 	val, ok := os.LookupEnv(key)
 	if !ok {
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+)
+
+// ExportOptions configures how query results are written to files.
+// Format is one of parquet, csv, ndjson or arrow. With PartitionBy, Path is a directory
+// that receives one sub directory per partition value, e.g. preen_source_name=tenant-a.
+type ExportOptions struct {
+	Format      string
+	Path        string
+	PartitionBy []string
+}
+
+var exportFormatExtensions = map[string]string{
+	"parquet": ".parquet",
+	"csv":     ".csv",
+	"ndjson":  ".ndjson",
+	"arrow":   ".arrow",
+}
+
+// GetExportFormat infers the export format from a file extension.
+func GetExportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".parquet":
+		return "parquet", nil
+	case ".csv":
+		return "csv", nil
+	case ".ndjson", ".jsonl", ".json":
+		return "ndjson", nil
+	case ".arrow", ".ipc":
+		return "arrow", nil
+	default:
+		return "", fmt.Errorf("unable to infer export format from %s. Allowed values are 'parquet', 'csv', 'ndjson', 'arrow'", path)
+	}
+}
+
+// ExportModels writes whole model tables to files. A single model is written to the output path,
+// multiple models are written to one file per model inside the output directory.
+func ExportModels(modelNames []string, opts ExportOptions) error {
+	if len(modelNames) == 1 {
+		return ExportQuery(fmt.Sprintf("select * from main.%s", modelTableName(ModelName(modelNames[0]))), opts)
+	}
+
+	if err := os.MkdirAll(opts.Path, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory at %s with error %w", opts.Path, err)
+	}
+	for _, modelName := range modelNames {
+		modelOpts := opts
+		modelOpts.Path = filepath.Join(opts.Path, modelTableName(ModelName(modelName)))
+		if len(opts.PartitionBy) == 0 {
+			modelOpts.Path += exportFormatExtensions[opts.Format]
+		}
+		query := fmt.Sprintf("select * from main.%s", modelTableName(ModelName(modelName)))
+		if err := ExportQuery(query, modelOpts); err != nil {
+			return fmt.Errorf("error exporting model %s: %w", modelName, err)
+		}
+	}
+	return nil
+}
+
+// ExportQuery writes the results of a query to a file. Parquet, CSV and NDJSON files are written
+// by DuckDB's COPY statement, Arrow IPC files through DuckDB's Arrow interface.
+func ExportQuery(query string, opts ExportOptions) error {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	Debug(fmt.Sprintf("Exporting query results to %s as %s", opts.Path, opts.Format))
+
+	copyOptions := make([]string, 0)
+	switch opts.Format {
+	case "parquet":
+		copyOptions = append(copyOptions, "format parquet")
+	case "csv":
+		copyOptions = append(copyOptions, "format csv", "header true")
+	case "ndjson":
+		copyOptions = append(copyOptions, "format json")
+	case "arrow":
+		if len(opts.PartitionBy) > 0 {
+			return fmt.Errorf("partitioning is not supported for arrow exports")
+		}
+		return exportArrow(query, opts.Path)
+	default:
+		return fmt.Errorf("invalid export format: %s. Allowed values are 'parquet', 'csv', 'ndjson', 'arrow'", opts.Format)
+	}
+	if len(opts.PartitionBy) > 0 {
+		copyOptions = append(copyOptions, fmt.Sprintf("partition_by (%s)", strings.Join(opts.PartitionBy, ", ")), "overwrite_or_ignore true")
+	}
+
+	copyStmt := fmt.Sprintf("copy (%s) to '%s' (%s)", query, strings.ReplaceAll(opts.Path, "'", "''"), strings.Join(copyOptions, ", "))
+	if err := ddbExec(copyStmt); err != nil {
+		return fmt.Errorf("error exporting to %s: %w", opts.Path, err)
+	}
+	Info(fmt.Sprintf("Exported query results to %s", opts.Path))
+	return nil
+}
+
+// exportArrow writes the query results to an Arrow IPC file, record batch by record batch.
+func exportArrow(query string, path string) error {
+	err := ddbQueryArrow(query, func(reader array.RecordReader) error {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create file at %s with error %w", path, err)
+		}
+		defer file.Close()
+
+		writer, err := ipc.NewFileWriter(file, ipc.WithSchema(reader.Schema()))
+		if err != nil {
+			return err
+		}
+		for reader.Next() {
+			if err = writer.Write(reader.Record()); err != nil {
+				return fmt.Errorf("error writing arrow record: %w", err)
+			}
+		}
+		if err = reader.Err(); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil {
+		return err
+	}
+	Info(fmt.Sprintf("Exported query results to %s", path))
+	return nil
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+)
+
+func TestGetExportFormat(t *testing.T) {
+	tests := []struct {
+		path        string
+		expected    string
+		expectError bool
+	}{
+		{"users.parquet", "parquet", false},
+		{"exports/users.CSV", "csv", false},
+		{"users.ndjson", "ndjson", false},
+		{"users.jsonl", "ndjson", false},
+		{"users.json", "ndjson", false},
+		{"users.arrow", "arrow", false},
+		{"users.ipc", "arrow", false},
+		{"users.xlsx", "", true},
+		{"users", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := GetExportFormat(tt.path)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("GetExportFormat(%s) = %s; want %s", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExportQueryRejectsInvalidOptions(t *testing.T) {
+	Initialize()
+	tests := []struct {
+		name string
+		opts ExportOptions
+	}{
+		{"invalid format", ExportOptions{Format: "xlsx", Path: "users.xlsx"}},
+		{"partitioned arrow", ExportOptions{Format: "arrow", Path: "users", PartitionBy: []string{"preen_source_name"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ExportQuery("select 1", tt.opts); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestExportModels(t *testing.T) {
+	dir := exportTestDatabase(t)
+
+	readers := map[string]string{
+		"parquet": "read_parquet('%s')",
+		"csv":     "read_csv('%s')",
+		"ndjson":  "read_json('%s', format = 'newline_delimited')",
+	}
+	for format, reader := range readers {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(dir, "users"+exportFormatExtensions[format])
+			if err := ExportModels([]string{"users"}, ExportOptions{Format: format, Path: path}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertExportedRows(t, reader, path, 3)
+		})
+	}
+
+	t.Run("multiple models", func(t *testing.T) {
+		path := filepath.Join(dir, "models")
+		if err := ExportModels([]string{"users", "user-events"}, ExportOptions{Format: "csv", Path: path}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertExportedRows(t, readers["csv"], filepath.Join(path, "users.csv"), 3)
+		assertExportedRows(t, readers["csv"], filepath.Join(path, "user_events.csv"), 1)
+	})
+}
+
+func TestExportQueryPartitionBy(t *testing.T) {
+	dir := exportTestDatabase(t)
+
+	path := filepath.Join(dir, "partitioned")
+	opts := ExportOptions{Format: "parquet", Path: path, PartitionBy: []string{"preen_source_name"}}
+	if err := ExportQuery("select * from main.users;", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, partition := range []string{"preen_source_name=eu", "preen_source_name=us"} {
+		files, err := filepath.Glob(filepath.Join(path, partition, "*.parquet"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(files) == 0 {
+			t.Errorf("expected parquet files in partition %s", partition)
+		}
+	}
+	assertExportedRows(t, "read_parquet('%s', hive_partitioning = true)", filepath.Join(path, "*", "*.parquet"), 3)
+}
+
+func TestExportArrow(t *testing.T) {
+	dir := exportTestDatabase(t)
+
+	path := filepath.Join(dir, "users.arrow")
+	if err := ExportQuery("select id, name from main.users order by id", ExportOptions{Format: "arrow", Path: path}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	reader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Close()
+	if fields := reader.Schema().Fields(); len(fields) != 2 || fields[0].Name != "id" || fields[1].Name != "name" {
+		t.Errorf("arrow schema = %v; want id, name", reader.Schema())
+	}
+	var rows int64
+	for i := 0; i < reader.NumRecords(); i++ {
+		record, err := reader.Record(i)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows += record.NumRows()
+	}
+	if rows != 3 {
+		t.Errorf("arrow file has %d rows; want 3", rows)
+	}
+}
+
+// exportTestDatabase creates the users and user_events model tables in a preen database in a
+// temporary working directory, and returns the directory.
+func exportTestDatabase(t *testing.T) string {
+	t.Helper()
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// ddbExec opens ./preenContext.db
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err = ddbExec("select 1"); err != nil {
+		t.Skipf("duckdb extensions unavailable: %v", err)
+	}
+
+	err = ddbExec(`create table main.users (preen_source_name varchar, id bigint, name varchar);
+		insert into main.users values ('eu', 1, 'Alice'), ('eu', 2, 'Bob'), ('us', 3, 'Carol');
+		create table main.user_events (preen_source_name varchar, id bigint);
+		insert into main.user_events values ('eu', 1);`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return dir
+}
+
+// assertExportedRows reads an exported file back with a DuckDB table function and checks its row count.
+func assertExportedRows(t *testing.T, reader string, path string, expected int64) {
+	t.Helper()
+	results, err := Execute(fmt.Sprintf("select count(*) as row_count from "+reader, path))
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %v", path, err)
+	}
+	if count := results.Rows[0]["row_count"]; count != expected {
+		t.Errorf("%s has %v rows; want %d", path, count, expected)
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ingestFileSource loads the files of a source into the file model table. The setup statements, e.g. the
+// secret of an s3 source, run in the same duckDB instance as the query reading the files.
+func ingestFileSource(r *Retriever, setup string) error {
+	reader, err := fileReader(r)
+	if err != nil {
+		return err
+	}
+	return ingestFileModel(r, reader, setup)
+}
+
+// fileReader returns the duckDB table function that reads the files of a model in its format.
+func fileReader(r *Retriever) (string, error) {
+	var options any
+	var function string
+	switch r.Format {
+	case "csv":
+		options, function = r.Options, "read_csv"
+	case "parquet":
+		options, function = r.ParquetOptions, "read_parquet"
+	case "json":
+		options, function = r.JSONOptions, "read_json"
+	case "ndjson":
+		options, function = r.JSONOptions, "read_ndjson"
+	default:
+		return "", fmt.Errorf("unsupported model file format %s", r.Format)
+	}
+	optionsString, err := getFileOptions(options)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s options: %v", r.Format, err)
+	}
+	if *optionsString == "" {
+		return fmt.Sprintf("%s(%s)", function, formatFilePatterns(r)), nil
+	}
+	return fmt.Sprintf("%s(%s,%s)", function, formatFilePatterns(r), *optionsString), nil
+}
+
+// fileModelLock serializes the sources of file models, since they all write to the model table.
+var fileModelLock sync.Mutex
+
+// ingestFileModel appends the rows a duckDB table function reads from a source to the file model table.
+// The first source creates the table with the columns of its files, later sources are inserted by name.
+func ingestFileModel(r *Retriever, reader string, setup string) error {
+	fileModelLock.Lock()
+	defer fileModelLock.Unlock()
+
+	sourceQuery := fmt.Sprintf(
+		"select '%s' as preen_source_name, * from %s", strings.ReplaceAll(r.Source.Name, "'", "''"), reader,
+	)
+	query := fmt.Sprintf(
+		"create table if not exists main.%s as %s limit 0; insert into main.%s by name %s;",
+		r.TableName, sourceQuery, r.TableName, sourceQuery,
+	)
+	exec := ddbExec
+	if setup != "" {
+		// The setup statement creates the source's secret, which must not be logged with the query
+		exec = func(query string) error { return ddbExecWithSetup(setup, query) }
+	}
+	if err := exec(query); err != nil {
+		return fmt.Errorf("failed to create file model table %s: %v", r.ModelName, err)
+	}
+	return nil
+}
+
+// formatFilePatterns returns the duckDB list of the file locations matched by the model's file patterns.
+func formatFilePatterns(r *Retriever) string {
+	locations := make([]string, 0, len(*r.FilePatterns))
+	for _, pattern := range *r.FilePatterns {
+		locations = append(locations, fmt.Sprintf("'%s'", strings.ReplaceAll(fileLocation(r.Source, pattern), "'", "''")))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(locations, ", "))
+}
+
+// fileLocation resolves a file pattern against the bucket of s3 sources or the base directory of local sources.
+func fileLocation(source Source, pattern string) string {
+	switch source.Engine {
+	case "local":
+		return filepath.Join(source.Connection.Path, pattern)
+	default:
+		return fmt.Sprintf("%s://%s", source.Engine, filepath.Join(source.Connection.BucketName, pattern))
+	}
+}
+
+// getFileOptions formats the options of a file model as duckDB reader parameters.
+// Every option needs a default tag, options without a value and default are left out.
+func getFileOptions(o any) (*string, error) {
+	options := reflect.VisibleFields(reflect.TypeOf(o))
+	queryString := new(string)
+	for _, option := range options {
+		if _, ok := option.Tag.Lookup("default"); !ok {
+			return nil, fmt.Errorf("missing default value for option %s", option.Name)
+		}
+		if _, ok := option.Tag.Lookup("yaml"); !ok {
+			return nil, fmt.Errorf("missing yaml tag for option %s", option.Name)
+		}
+
+		defaultVal := option.Tag.Get("default")
+		optionName := option.Tag.Get("yaml")
+		optionValue := getDefaultValue(reflect.ValueOf(o).FieldByName(option.Name).Interface(), defaultVal)
+		if optionValue == "" {
+			continue
+		}
+		optionString := fmt.Sprintf("%s = %v", optionName, optionValue)
+		if *queryString == "" {
+			*queryString += optionString
+		} else {
+			*queryString = fmt.Sprintf("%s, %s", *queryString, optionString)
+		}
+	}
+	return queryString, nil
+}
+
+func getDefaultValue(key any, defaultVal any) any {
+	switch key := key.(type) {
+	case *[]string:
+		// If the key is not set and there is not default value, return an empty string
+		if key == nil && defaultVal == "-" {
+			return ""
+		}
+		// If the key is not set and there is a default value, return the default value
+		if key == nil && defaultVal != "-" {
+			return defaultVal
+		}
+		// Convert the []string from YAML to a string array for the query
+		queryString := "["
+		for i, v := range *key {
+			if i == len(*key)-1 {
+				queryString += v + "]"
+				break
+			}
+			queryString += v + ", "
+		}
+		return queryString
+	case *bool:
+		if key == nil {
+			return defaultVal
+		}
+		return *key
+	case *string:
+		// If the key is not set and there is not default value, return an empty string
+		if key == nil && defaultVal == "-" {
+			return ""
+		}
+		// If the key is not set and there is a default value, return the default value
+		if key == nil && defaultVal != "-" {
+			return fmt.Sprintf("'%s'", defaultVal)
+		}
+		return fmt.Sprintf("'%s'", *key)
+	case *int64:
+		if key == nil {
+			return defaultVal
+		}
+		return *key
+	case *[]Type:
+		// If the key is not set and there is not default value, return an empty string
+		if key == nil && defaultVal == "-" {
+			return ""
+		}
+		// If the key is not set and there is a default value, return the default value
+		if key == nil && defaultVal != "-" {
+			return defaultVal
+		}
+		// Convert the []Type from YAML to a string object for the query
+		queryString := "{"
+		for i, v := range *key {
+			if i == len(*key)-1 {
+				queryString += fmt.Sprintf("'%s': '%s'", v.Name, v.Type) + "}"
+				break
+			}
+			queryString += fmt.Sprintf("'%s': '%s',", v.Name, v.Type)
+		}
+		return queryString
+	}
+	return key
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatFilePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   Source
+		patterns []string
+		expected string
+	}{
+		{"s3", Source{Engine: "s3", Connection: Connection{BucketName: "users"}}, []string{"v1/**.csv", "v2/*.csv"}, "['s3://users/v1/**.csv', 's3://users/v2/*.csv']"},
+		{"local", Source{Engine: "local", Connection: Connection{Path: "/data/exports"}}, []string{"users/*.parquet"}, "['/data/exports/users/*.parquet']"},
+		{"relative local path", Source{Engine: "local", Connection: Connection{Path: "fixtures"}}, []string{"o'brien.csv"}, "['fixtures/o''brien.csv']"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := formatFilePatterns(&Retriever{Source: tt.source, FilePatterns: &tt.patterns})
+			if result != tt.expected {
+				t.Errorf("formatFilePatterns() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocalEngineConnect(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "users.csv")
+	if err := os.WriteFile(file, []byte("id\n1\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		expectError bool
+	}{
+		{"directory", dir, false},
+		{"missing path", "", true},
+		{"missing directory", filepath.Join(dir, "missing"), true},
+		{"file", file, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newLocalEngine(Source{Name: "fixtures", Engine: "local", Connection: Connection{Path: tt.path}}).Connect()
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// modelTableName is the DuckDB table a model is stored in.
+func modelTableName(name ModelName) string {
+	return strings.ReplaceAll(string(name), "-", "_")
+}
+
+// getModelDependencies maps every model to the models it reads from. Only transform models
+// have dependencies, inferred from the model tables referenced in their query.
+func getModelDependencies(mc *ModelConfig) map[ModelName][]ModelName {
+	modelsByTable := make(map[TableName]ModelName)
+	for _, model := range mc.Models {
+		modelsByTable[TableName(modelTableName(model.Name))] = model.Name
+		modelsByTable[TableName(model.Name)] = model.Name
+	}
+
+	dependencies := make(map[ModelName][]ModelName)
+	for _, model := range mc.Models {
+		dependencies[model.Name] = make([]ModelName, 0)
+		if model.Type != "transform" {
+			continue
+		}
+		for _, tableName := range model.TableSet {
+			// Model tables live in DuckDB's main schema, e.g. main.orders
+			_, table := splitTableName(tableName)
+			dependency, ok := modelsByTable[TableName(table)]
+			if ok && dependency != model.Name && !slices.Contains(dependencies[model.Name], dependency) {
+				dependencies[model.Name] = append(dependencies[model.Name], dependency)
+			}
+		}
+	}
+	return dependencies
+}
+
+// sortTransformModels returns the transform models ordered so that every model comes after its dependencies.
+func sortTransformModels(mc *ModelConfig) ([]*Model, error) {
+	dependencies := getModelDependencies(mc)
+	sorted := make([]*Model, 0)
+	built := make(map[ModelName]bool)
+	// Extraction models are always built before any transform model
+	for _, model := range mc.Models {
+		if model.Type != "transform" {
+			built[model.Name] = true
+		}
+	}
+
+	for len(built) < len(mc.Models) {
+		progress := false
+		for _, model := range mc.Models {
+			if built[model.Name] {
+				continue
+			}
+			ready := true
+			for _, dependency := range dependencies[model.Name] {
+				if !built[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, model)
+				built[model.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			cyclic := make([]string, 0)
+			for _, model := range mc.Models {
+				if !built[model.Name] {
+					cyclic = append(cyclic, string(model.Name))
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle detected between models: %s", strings.Join(cyclic, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+// buildTransformModels runs every transform model's query inside DuckDB in dependency order.
+func buildTransformModels(mc *ModelConfig) error {
+	transforms, err := sortTransformModels(mc)
+	if err != nil {
+		return err
+	}
+	for _, model := range transforms {
+		Info(fmt.Sprintf("Building transform model %s", model.Name))
+		query := strings.TrimSuffix(strings.TrimSpace(model.Query), ";")
+		if err = ddbExec(fmt.Sprintf("create or replace table main.%s as %s", modelTableName(model.Name), query)); err != nil {
+			return fmt.Errorf("error building transform model %s: %w", model.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseGraphTarget splits a graph selector such as +orders+ into the model name and whether its
+// upstream (leading +) and downstream (trailing +) models are selected.
+func parseGraphTarget(target string) (ModelName, bool, bool) {
+	upstream := strings.HasPrefix(target, "+")
+	downstream := strings.HasSuffix(target, "+")
+	return ModelName(strings.Trim(target, "+")), upstream, downstream
+}
+
+func isGraphTarget(target string) bool {
+	return strings.HasPrefix(target, "+") || strings.HasSuffix(target, "+")
+}
+
+// selectModelGraph keeps only the target model and, depending on the selector, its upstream and downstream models.
+func selectModelGraph(mc *ModelConfig, target string) error {
+	name, upstream, downstream := parseGraphTarget(target)
+	dependencies := getModelDependencies(mc)
+	if _, ok := dependencies[name]; !ok {
+		return fmt.Errorf("target model %s not found", name)
+	}
+
+	dependents := make(map[ModelName][]ModelName)
+	for model, modelDependencies := range dependencies {
+		for _, dependency := range modelDependencies {
+			dependents[dependency] = append(dependents[dependency], model)
+		}
+	}
+
+	selected := map[ModelName]bool{name: true}
+	if upstream {
+		walkModelGraph(name, dependencies, selected)
+	}
+	if downstream {
+		walkModelGraph(name, dependents, selected)
+	}
+
+	models := make([]*Model, 0, len(selected))
+	for _, model := range mc.Models {
+		if selected[model.Name] {
+			models = append(models, model)
+		}
+	}
+	mc.Models = models
+	return nil
+}
+
+func walkModelGraph(name ModelName, edges map[ModelName][]ModelName, selected map[ModelName]bool) {
+	for _, next := range edges[name] {
+		if !selected[next] {
+			selected[next] = true
+			walkModelGraph(next, edges, selected)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"testing"
+)
+
+func testModelGraph() *ModelConfig {
+	return &ModelConfig{
+		Models: []*Model{
+			{Name: "order-summary", Type: "transform", TableSet: TableSet{"orders_enriched"}},
+			{Name: "orders_enriched", Type: "transform", TableSet: TableSet{"orders", "main.users"}},
+			{Name: "orders", Type: "database", TableSet: TableSet{"orders"}},
+			{Name: "users", Type: "database", TableSet: TableSet{"users"}},
+		},
+	}
+}
+
+func TestSortTransformModels(t *testing.T) {
+	sorted, err := sortTransformModels(testModelGraph())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sorted) != 2 {
+		t.Fatalf("expected 2 transform models, got %d", len(sorted))
+	}
+	if sorted[0].Name != "orders_enriched" || sorted[1].Name != "order-summary" {
+		t.Errorf("unexpected order: %s, %s", sorted[0].Name, sorted[1].Name)
+	}
+}
+
+func TestSortTransformModelsCycle(t *testing.T) {
+	mc := &ModelConfig{
+		Models: []*Model{
+			{Name: "a", Type: "transform", TableSet: TableSet{"b"}},
+			{Name: "b", Type: "transform", TableSet: TableSet{"a"}},
+		},
+	}
+	if _, err := sortTransformModels(mc); err == nil {
+		t.Errorf("expected dependency cycle error, got nil")
+	}
+}
+
+func TestSelectModelGraph(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected []ModelName
+	}{
+		{"+orders_enriched", []ModelName{"orders_enriched", "orders", "users"}},
+		{"orders_enriched+", []ModelName{"order-summary", "orders_enriched"}},
+		{"users+", []ModelName{"order-summary", "orders_enriched", "users"}},
+		{"+order-summary", []ModelName{"order-summary", "orders_enriched", "orders", "users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			mc := testModelGraph()
+			if err := selectModelGraph(mc, tt.target); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(mc.Models) != len(tt.expected) {
+				t.Fatalf("expected %d models, got %d", len(tt.expected), len(mc.Models))
+			}
+			for i, model := range mc.Models {
+				if model.Name != tt.expected[i] {
+					t.Errorf("expected model %s, got %s", tt.expected[i], model.Name)
+				}
+			}
+		})
+	}
+
+	if err := selectModelGraph(testModelGraph(), "+missing"); err == nil {
+		t.Errorf("expected error for missing target model, got nil")
+	}
+}
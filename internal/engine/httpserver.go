@@ -0,0 +1,401 @@
+package engine
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+)
+
+const (
+	ndjsonContentType      = "application/x-ndjson"
+	arrowStreamContentType = "application/vnd.apache.arrow.stream"
+	// NDJSON responses are flushed to the client every httpFlushRows rows
+	httpFlushRows = 1000
+	// Finished build jobs are kept for buildJobTTL so clients can poll their status, then evicted
+	buildJobTTL = 24 * time.Hour
+)
+
+// BuildJob is a model build started through the HTTP API. Builds run in the background one at a
+// time, and their status is polled with GET /builds/{id}.
+type BuildJob struct {
+	ID          string     `json:"id"`
+	Target      string     `json:"target"`
+	FullRefresh bool       `json:"full_refresh"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// ModelColumn is a column of a model as described by its sources in the information schema.
+type ModelColumn struct {
+	Name        string   `json:"name"`
+	DataTypes   []string `json:"data_types"`
+	SourceNames []string `json:"source_names"`
+}
+
+// ModelDescription lists a model's columns.
+type ModelDescription struct {
+	Name    string        `json:"name"`
+	Columns []ModelColumn `json:"columns"`
+}
+
+type queryRequest struct {
+	Query  string `json:"query"`
+	Format string `json:"format"`
+}
+
+type buildRequest struct {
+	Target      string `json:"target"`
+	FullRefresh bool   `json:"full_refresh"`
+}
+
+type httpAPI struct {
+	mu        sync.Mutex
+	jobs      map[string]*BuildJob
+	nextJobID int
+	// Model builds write to the same DuckDB tables, so they are never run concurrently
+	buildMu sync.Mutex
+	// build runs a model build, buildModelTarget unless replaced in tests
+	build func(target string, fullRefresh bool) error
+	// Bearer token clients authenticate with, every client is trusted if empty
+	token string
+}
+
+func newHTTPAPI(token string) *httpAPI {
+	return &httpAPI{jobs: make(map[string]*BuildJob), build: buildModelTarget, token: token}
+}
+
+// ServeHTTPAPI serves the preen HTTP API. It runs SQL against the preen DuckDB database, describes
+// the models in the information schema and builds models in the background. Clients authenticate with
+// the bearer token if one is set, and the API only listens on non-loopback addresses with a token.
+func ServeHTTPAPI(addr string, token string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	defer listener.Close()
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok && !tcpAddr.IP.IsLoopback() && token == "" {
+		return fmt.Errorf("refusing to serve on non-loopback address %s without a token. Set --http-token or PREEN_HTTP_TOKEN", listener.Addr())
+	}
+
+	api := newHTTPAPI(token)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /query", api.handleQuery)
+	mux.HandleFunc("GET /models", api.handleListModels)
+	mux.HandleFunc("GET /models/{name}", api.handleGetModel)
+	mux.HandleFunc("POST /builds", api.handleCreateBuild)
+	mux.HandleFunc("GET /builds/{id}", api.handleGetBuild)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	Info(fmt.Sprintf("Serving the preen HTTP API on %s", listener.Addr()))
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server failed: %w", err)
+	}
+	return nil
+}
+
+// authenticate rejects requests without the API's bearer token in the Authorization header.
+func (api *httpAPI) authenticate(next http.Handler) http.Handler {
+	if api.token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + api.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHTTPError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleQuery runs the SQL in the request body. Results are streamed as NDJSON, one object per row,
+// or as an Arrow IPC stream when the format is arrow or the client accepts the Arrow stream content type.
+func (api *httpAPI) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("query is required"))
+		return
+	}
+	if req.Format == "" {
+		req.Format = r.URL.Query().Get("format")
+	}
+	if req.Format == "" && strings.Contains(r.Header.Get("Accept"), arrowStreamContentType) {
+		req.Format = "arrow"
+	}
+
+	switch req.Format {
+	case "", "ndjson":
+		api.streamNDJSON(w, req.Query)
+	case "arrow":
+		api.streamArrow(w, req.Query)
+	default:
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid format: %s. Allowed values are 'ndjson' or 'arrow'", req.Format))
+	}
+}
+
+func (api *httpAPI) streamNDJSON(w http.ResponseWriter, query string) {
+	qs, err := StreamQuery(query)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer qs.Close()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	// Rows are read as the client consumes them, a slow client slows down the query instead of buffering rows
+	for i := 1; qs.Next(); i++ {
+		if err = encoder.Encode(qs.Row()); err != nil {
+			Debug(fmt.Sprintf("Error writing query results to http client: %s", err))
+			return
+		}
+		if i%httpFlushRows == 0 {
+			if err = controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	// Once the stream has started the status can no longer change, the client sees a truncated stream
+	if err = qs.Err(); err != nil {
+		Debug(fmt.Sprintf("Error reading query results for http client: %s", err))
+	}
+}
+
+func (api *httpAPI) streamArrow(w http.ResponseWriter, query string) {
+	wroteHeader := false
+	err := ddbQueryArrow(strings.TrimSuffix(strings.TrimSpace(query), ";"), func(reader array.RecordReader) error {
+		w.Header().Set("Content-Type", arrowStreamContentType)
+		wroteHeader = true
+		writer := ipc.NewWriter(w, ipc.WithSchema(reader.Schema()))
+		for reader.Next() {
+			if err := writer.Write(reader.Record()); err != nil {
+				return err
+			}
+		}
+		if err := reader.Err(); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+	if err != nil {
+		// Once the stream has started the status can no longer change, the client sees a truncated stream
+		if wroteHeader {
+			Debug(fmt.Sprintf("Error writing arrow stream to http client: %s", err))
+			return
+		}
+		writeHTTPError(w, http.StatusBadRequest, err)
+	}
+}
+
+func (api *httpAPI) handleListModels(w http.ResponseWriter, r *http.Request) {
+	models, err := describeModels("")
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, models)
+}
+
+func (api *httpAPI) handleGetModel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	models, err := describeModels(name)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(models) == 0 {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("model %s not found", name))
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, models[0])
+}
+
+// describeModels reads the models and their columns from the information schema. If modelName is
+// set, only that model is described.
+func describeModels(modelName string) ([]ModelDescription, error) {
+	query := `
+		select model_name, column_name,
+			list(distinct data_type order by data_type) as data_types,
+			list(distinct source_name order by source_name) as source_names
+		from main.preen_information_schema
+		where $1 = '' or model_name = $1
+		group by model_name, column_name
+		order by model_name, column_name`
+	results, err := Execute(query, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading information schema: %w", err)
+	}
+
+	models := make([]ModelDescription, 0)
+	for _, row := range results.Rows {
+		name := fmt.Sprint(row["model_name"])
+		if len(models) == 0 || models[len(models)-1].Name != name {
+			models = append(models, ModelDescription{Name: name, Columns: make([]ModelColumn, 0)})
+		}
+		model := &models[len(models)-1]
+		model.Columns = append(model.Columns, ModelColumn{
+			Name:        fmt.Sprint(row["column_name"]),
+			DataTypes:   toStringSlice(row["data_types"]),
+			SourceNames: toStringSlice(row["source_names"]),
+		})
+	}
+	return models, nil
+}
+
+func toStringSlice(value any) []string {
+	values, _ := value.([]any)
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			strs = append(strs, fmt.Sprint(v))
+		}
+	}
+	return strs
+}
+
+// handleCreateBuild starts a model build in the background and responds with the queued job.
+func (api *httpAPI) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
+	var req buildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	api.mu.Lock()
+	api.evictFinishedJobs(time.Now().UTC())
+	api.nextJobID++
+	job := &BuildJob{
+		ID:          strconv.Itoa(api.nextJobID),
+		Target:      req.Target,
+		FullRefresh: req.FullRefresh,
+		Status:      "queued",
+		CreatedAt:   time.Now().UTC(),
+	}
+	api.jobs[job.ID] = job
+	response := *job
+	api.mu.Unlock()
+
+	go api.runBuild(job)
+
+	w.Header().Set("Location", "/builds/"+job.ID)
+	writeHTTPJSON(w, http.StatusAccepted, response)
+}
+
+func (api *httpAPI) handleGetBuild(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	job, ok := api.jobs[r.PathValue("id")]
+	var response BuildJob
+	if ok {
+		response = *job
+	}
+	api.mu.Unlock()
+
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("build %s not found", r.PathValue("id")))
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, response)
+}
+
+func (api *httpAPI) runBuild(job *BuildJob) {
+	api.buildMu.Lock()
+	defer api.buildMu.Unlock()
+
+	api.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.Status = "running"
+		job.StartedAt = &now
+	})
+	Info(fmt.Sprintf("Starting build %s", job.ID))
+
+	err := api.runBuildTarget(job)
+
+	api.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = "failed"
+			job.Error = err.Error()
+		} else {
+			job.Status = "succeeded"
+		}
+	})
+	if err != nil {
+		Errorf("Build %s failed: %s", job.ID, err)
+		return
+	}
+	Info(fmt.Sprintf("Build %s succeeded", job.ID))
+}
+
+// runBuildTarget builds the job's target. Builds panic on some errors, such as failed inserts, so a
+// panic is recovered and reported as the job error instead of stopping the server.
+func (api *httpAPI) runBuildTarget(job *BuildJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("build panicked: %v", r)
+		}
+	}()
+	return api.build(job.Target, job.FullRefresh)
+}
+
+// evictFinishedJobs removes the jobs that finished more than buildJobTTL before now. The caller holds mu.
+func (api *httpAPI) evictFinishedJobs(now time.Time) {
+	for id, job := range api.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > buildJobTTL {
+			delete(api.jobs, id)
+		}
+	}
+}
+
+func (api *httpAPI) updateJob(job *BuildJob, update func()) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	update()
+}
+
+// buildModelTarget reads the config and builds the target models, as preen model build does.
+func buildModelTarget(target string, fullRefresh bool) error {
+	sc, mc, err := GetConfig(target)
+	if err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	mc.FullRefresh = fullRefresh
+
+	return BuildModels(sc, mc)
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		Debug(fmt.Sprintf("Error writing http response: %s", err))
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeHTTPJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPAPIRejectsInvalidRequests(t *testing.T) {
+	api := newHTTPAPI("")
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		handler  http.HandlerFunc
+		expected int
+	}{
+		{"missing query", "POST", "/query", `{}`, api.handleQuery, http.StatusBadRequest},
+		{"invalid body", "POST", "/query", `{"query":`, api.handleQuery, http.StatusBadRequest},
+		{"invalid format", "POST", "/query", `{"query":"select 1","format":"xml"}`, api.handleQuery, http.StatusBadRequest},
+		{"unknown build", "GET", "/builds/7", ``, api.handleGetBuild, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.SetPathValue("id", "7")
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("expected error body, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPAPIBuildJobs(t *testing.T) {
+	tests := []struct {
+		name           string
+		build          func(target string, fullRefresh bool) error
+		expectedStatus string
+		expectedError  string
+	}{
+		{"succeeded", func(string, bool) error { return nil }, "succeeded", ""},
+		{"failed", func(string, bool) error { return errors.New("model not found") }, "failed", "model not found"},
+		{"panicked", func(string, bool) error { panic("failed to append row") }, "failed", "build panicked: failed to append row"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newHTTPAPI("")
+			api.build = tt.build
+
+			req := httptest.NewRequest("POST", "/builds", strings.NewReader(`{"target":"users"}`))
+			rec := httptest.NewRecorder()
+			api.handleCreateBuild(rec, req)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body.String())
+			}
+			var created BuildJob
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+				t.Fatalf("invalid build response: %v", err)
+			}
+			if rec.Header().Get("Location") != "/builds/"+created.ID {
+				t.Errorf("expected location /builds/%s, got %s", created.ID, rec.Header().Get("Location"))
+			}
+
+			job := pollBuild(t, api, created.ID)
+			if job.Status != tt.expectedStatus {
+				t.Errorf("expected status %s, got %s", tt.expectedStatus, job.Status)
+			}
+			if job.Error != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, job.Error)
+			}
+			if job.Target != "users" || job.StartedAt == nil || job.FinishedAt == nil {
+				t.Errorf("unexpected build job: %+v", job)
+			}
+		})
+	}
+}
+
+func TestHTTPAPIEvictsFinishedJobs(t *testing.T) {
+	api := newHTTPAPI("")
+	now := time.Now().UTC()
+	expired := now.Add(-buildJobTTL - time.Minute)
+	recent := now.Add(-time.Minute)
+	api.jobs["1"] = &BuildJob{ID: "1", Status: "succeeded", FinishedAt: &expired}
+	api.jobs["2"] = &BuildJob{ID: "2", Status: "failed", FinishedAt: &recent}
+	api.jobs["3"] = &BuildJob{ID: "3", Status: "running", StartedAt: &expired}
+
+	api.evictFinishedJobs(now)
+
+	if _, ok := api.jobs["1"]; ok {
+		t.Errorf("expected expired job 1 to be evicted")
+	}
+	for _, id := range []string{"2", "3"} {
+		if _, ok := api.jobs[id]; !ok {
+			t.Errorf("expected job %s to be kept", id)
+		}
+	}
+}
+
+// pollBuild polls GET /builds/{id} until the build finishes.
+func pollBuild(t *testing.T, api *httpAPI, id string) BuildJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest("GET", "/builds/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		api.handleGetBuild(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var job BuildJob
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("invalid build response: %v", err)
+		}
+		if job.Status == "succeeded" || job.Status == "failed" {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build %s did not finish, status %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPAPIRequiresToken(t *testing.T) {
+	api := newHTTPAPI("s3cr3t")
+	handler := api.authenticate(http.HandlerFunc(api.handleGetBuild))
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"valid token", "Bearer s3cr3t", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/builds/7", nil)
+			req.SetPathValue("id", "7")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeHTTPAPIRefusesRemoteAddressWithoutToken(t *testing.T) {
+	Initialize()
+	err := ServeHTTPAPI("0.0.0.0:0", "")
+	if err == nil || !strings.Contains(err.Error(), "without a token") {
+		t.Errorf("expected non-loopback address error, got %v", err)
+	}
+}
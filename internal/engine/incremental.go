@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/preendata/sqlparser"
+)
+
+// Incremental configures a database model to only retrieve rows past the cursor stored by the previous build.
+// CursorColumn and UniqueKey refer to columns of the model table, i.e. the aliases in the model query.
+// Without a unique key, new rows are appended to the model table instead of merged.
+type Incremental struct {
+	CursorColumn string   `yaml:"cursor_column"`
+	UniqueKey    []string `yaml:"unique_key"`
+}
+
+const incrementalCursorsTable = "main.preen_incremental_cursors"
+
+// validateIncremental checks that the cursor column and unique key are selected by the model query.
+func validateIncremental(model *Model) error {
+	if model.Incremental == nil {
+		return nil
+	}
+	if model.Incremental.CursorColumn == "" {
+		return fmt.Errorf("cursor_column required")
+	}
+	selectStmt, ok := model.Parsed.(*sqlparser.Select)
+	if !ok {
+		return fmt.Errorf("non-select queries not supported")
+	}
+	aliases := getSelectAliases(selectStmt)
+	if !slices.Contains(aliases, model.Incremental.CursorColumn) {
+		return fmt.Errorf("cursor_column %s is not selected by the model query", model.Incremental.CursorColumn)
+	}
+	for _, key := range model.Incremental.UniqueKey {
+		if !slices.Contains(aliases, key) {
+			return fmt.Errorf("unique_key column %s is not selected by the model query", key)
+		}
+	}
+	return nil
+}
+
+// getSelectAliases returns the names of the columns a select statement produces.
+func getSelectAliases(stmt *sqlparser.Select) []string {
+	aliases := make([]string, 0)
+	for _, selectExpr := range stmt.SelectExprs {
+		expr, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		if expr.As.String() != "" {
+			aliases = append(aliases, expr.As.String())
+		} else if colName, ok := expr.Expr.(*sqlparser.ColName); ok {
+			aliases = append(aliases, colName.Name.String())
+		}
+	}
+	return aliases
+}
+
+// stagingTableName is the table that receives the rows of an incremental build before they are merged.
+func stagingTableName(tableName string) string {
+	return tableName + "_preen_staging"
+}
+
+// buildIncrementalTables creates the model table if it does not exist yet, a fresh staging table
+// and the cursor table. A full refresh recreates the model table and forgets the model's cursors.
+// Without a full refresh, the model table has to have the columns of the current model query.
+func buildIncrementalTables(model *Model, fullRefresh bool) error {
+	tableName := strings.ReplaceAll(string(model.Name), "-", "_")
+	createStagingStmt := fmt.Sprintf("create or replace table main.%s (%s);", stagingTableName(tableName), model.DDLString)
+	if err := ddbExec(createStagingStmt); err != nil {
+		return fmt.Errorf("error creating staging table for %s: %w", tableName, err)
+	}
+
+	createTableStmt := fmt.Sprintf("create table if not exists main.%s (%s);", tableName, model.DDLString)
+	if fullRefresh {
+		createTableStmt = fmt.Sprintf("create or replace table main.%s (%s);", tableName, model.DDLString)
+	} else if err := checkIncrementalColumns(model, tableName); err != nil {
+		return err
+	}
+	Debug(fmt.Sprintf("Creating incremental table %s", tableName))
+	if err := ddbExec(createTableStmt); err != nil {
+		return fmt.Errorf("error creating table %s: %w", tableName, err)
+	}
+
+	createCursorsStmt := fmt.Sprintf(
+		`create table if not exists %[1]s (model_name varchar, source_name varchar, cursor_value varchar, updated_at timestamp);
+		alter table %[1]s add column if not exists cursor_type varchar;`,
+		incrementalCursorsTable,
+	)
+	if err := ddbExec(createCursorsStmt); err != nil {
+		return fmt.Errorf("error creating incremental cursors table: %w", err)
+	}
+
+	if fullRefresh {
+		Info(fmt.Sprintf("Full refresh of incremental model %s", model.Name))
+		if err := ddbExec(fmt.Sprintf("delete from %s where model_name = '%s'", incrementalCursorsTable, model.Name)); err != nil {
+			return fmt.Errorf("error resetting cursors for %s: %w", model.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkIncrementalColumns compares the columns of an existing model table with the staging table,
+// which is created from the current model query. Merging rows with different columns would fail
+// or shift values into the wrong columns, so a changed model needs a full refresh.
+func checkIncrementalColumns(model *Model, tableName string) error {
+	existing, err := getTableColumns(tableName)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	expected, err := getTableColumns(stagingTableName(tableName))
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(existing, expected) {
+		return fmt.Errorf(
+			"columns of model %s changed from (%s) to (%s). Run `preen model build --full-refresh` to rebuild it",
+			model.Name, strings.Join(existing, ", "), strings.Join(expected, ", "),
+		)
+	}
+	return nil
+}
+
+// getTableColumns returns the columns of a table in the main schema as "name type", in column order.
+// A table that does not exist has no columns.
+func getTableColumns(tableName string) ([]string, error) {
+	db, rows, err := ddbQuery(
+		`select column_name, data_type from information_schema.columns
+		where table_catalog = current_database() and table_schema = 'main' and table_name = $1
+		order by ordinal_position`,
+		tableName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %w", tableName, err)
+	}
+	defer db.Close()
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var columnName, dataType string
+		if err = rows.Scan(&columnName, &dataType); err != nil {
+			return nil, fmt.Errorf("error reading columns of %s: %w", tableName, err)
+		}
+		columns = append(columns, columnName+" "+dataType)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %w", tableName, err)
+	}
+	return columns, nil
+}
+
+// incrementalCursor is the stored high-water mark of a source and the DuckDB type of the cursor column.
+// CDC cursors are replication positions and have no type.
+type incrementalCursor struct {
+	value    string
+	dataType string
+}
+
+// getIncrementalCursors returns the stored high-water mark of every source for a model.
+func getIncrementalCursors(model *Model) (map[string]incrementalCursor, error) {
+	db, rows, err := ddbQuery(fmt.Sprintf(
+		"select source_name, cursor_value, coalesce(cursor_type, '') from %s where model_name = $1 and cursor_value is not null",
+		incrementalCursorsTable,
+	), string(model.Name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading incremental cursors for %s: %w", model.Name, err)
+	}
+	defer db.Close()
+	defer rows.Close()
+
+	cursors := make(map[string]incrementalCursor)
+	for rows.Next() {
+		var sourceName string
+		var cursor incrementalCursor
+		if err = rows.Scan(&sourceName, &cursor.value, &cursor.dataType); err != nil {
+			return nil, fmt.Errorf("error reading incremental cursors for %s: %w", model.Name, err)
+		}
+		cursors[sourceName] = cursor
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading incremental cursors for %s: %w", model.Name, err)
+	}
+	return cursors, nil
+}
+
+// incrementalQuery wraps the model query so only rows past the source's cursor are retrieved.
+// Wrapping keeps the model query untouched, the source database pushes the filter down.
+// Sources without a stored cursor retrieve every row.
+func incrementalQuery(model *Model, cursor incrementalCursor) string {
+	if cursor.value == "" {
+		return model.Query
+	}
+	query := strings.TrimSuffix(strings.TrimSpace(model.Query), ";")
+	return fmt.Sprintf(
+		"select * from (%s) as preen_incremental where preen_incremental.%s > %s",
+		query, model.Incremental.CursorColumn, formatCursorLiteral(cursor),
+	)
+}
+
+// numericCursorTypes are the DuckDB types of cursor columns compared as numbers.
+var numericCursorTypes = []string{
+	"TINYINT", "SMALLINT", "INTEGER", "BIGINT", "HUGEINT",
+	"UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT", "UHUGEINT",
+	"FLOAT", "DOUBLE", "DECIMAL",
+}
+
+// formatCursorLiteral leaves cursors of numeric columns unquoted and quotes everything else, e.g. timestamps
+// and varchars that look like numbers. A quoted literal is converted to the column's type by the source
+// database, which keeps the filter portable across SQL dialects.
+func formatCursorLiteral(cursor incrementalCursor) string {
+	dataType, _, _ := strings.Cut(strings.ToUpper(cursor.dataType), "(")
+	if slices.Contains(numericCursorTypes, dataType) {
+		if _, err := strconv.ParseFloat(cursor.value, 64); err == nil {
+			return cursor.value
+		}
+	}
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(cursor.value, "'", "''"))
+}
+
+// mergeIncrementalModel upserts the staged rows into the model table on the unique key
+// and stores the new high-water mark of every source.
+func mergeIncrementalModel(model *Model, tableName string) error {
+	stagingTable := stagingTableName(tableName)
+	queries := []string{"begin transaction"}
+	if len(model.Incremental.UniqueKey) > 0 {
+		// Rows are unique per source, so the source name is always part of the key.
+		conditions := []string{fmt.Sprintf("main.%s.preen_source_name = s.preen_source_name", tableName)}
+		for _, key := range model.Incremental.UniqueKey {
+			conditions = append(conditions, fmt.Sprintf("main.%s.%s = s.%s", tableName, key, key))
+		}
+		queries = append(queries, fmt.Sprintf(
+			"delete from main.%s using main.%s as s where %s",
+			tableName, stagingTable, strings.Join(conditions, " and "),
+		))
+	}
+	queries = append(queries,
+		fmt.Sprintf("insert into main.%s select * from main.%s", tableName, stagingTable),
+		fmt.Sprintf("drop table main.%s", stagingTable),
+		fmt.Sprintf("delete from %s where model_name = '%s'", incrementalCursorsTable, model.Name),
+		fmt.Sprintf(
+			`insert into %[1]s (model_name, source_name, cursor_value, cursor_type, updated_at)
+			select '%[2]s', preen_source_name, max(%[3]s)::varchar, typeof(max(%[3]s)), now() from main.%[4]s group by preen_source_name`,
+			incrementalCursorsTable, model.Name, model.Incremental.CursorColumn, tableName,
+		),
+		"commit",
+	)
+
+	Debug(fmt.Sprintf("Merging incremental model %s", model.Name))
+	if err := ddbExec(strings.Join(queries, ";\n")); err != nil {
+		return fmt.Errorf("error merging incremental model %s: %w", model.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/preendata/sqlparser"
+)
+
+func TestIncrementalQuery(t *testing.T) {
+	model := &Model{
+		Query:       "select orders.id, orders.updated_at as modified from orders;\n",
+		Incremental: &Incremental{CursorColumn: "modified"},
+	}
+
+	wrapped := "select * from (select orders.id, orders.updated_at as modified from orders) as preen_incremental where preen_incremental.modified > "
+	tests := []struct {
+		name     string
+		cursor   incrementalCursor
+		expected string
+	}{
+		{"no cursor", incrementalCursor{}, model.Query},
+		{"numeric cursor", incrementalCursor{"42", "BIGINT"}, wrapped + "42"},
+		{"decimal cursor", incrementalCursor{"42.50", "DECIMAL(10,2)"}, wrapped + "42.50"},
+		{"timestamp cursor", incrementalCursor{"2024-01-01 10:00:00", "TIMESTAMP"}, wrapped + "'2024-01-01 10:00:00'"},
+		{"numeric varchar cursor", incrementalCursor{"00123", "VARCHAR"}, wrapped + "'00123'"},
+		{"exponent varchar cursor", incrementalCursor{"1e5", "VARCHAR"}, wrapped + "'1e5'"},
+		{"untyped cursor", incrementalCursor{"42", ""}, wrapped + "'42'"},
+		{"quoted cursor", incrementalCursor{"o'brien", "VARCHAR"}, wrapped + "'o''brien'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := incrementalQuery(model, tt.cursor); result != tt.expected {
+				t.Errorf("incrementalQuery() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateIncremental(t *testing.T) {
+	stmt, err := sqlparser.Parse("select orders.id, orders.updated_at as modified from orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		incremental *Incremental
+		expectError bool
+	}{
+		{"valid", &Incremental{CursorColumn: "modified", UniqueKey: []string{"id"}}, false},
+		{"missing cursor", &Incremental{UniqueKey: []string{"id"}}, true},
+		{"cursor not selected", &Incremental{CursorColumn: "updated_at"}, true},
+		{"unique key not selected", &Incremental{CursorColumn: "modified", UniqueKey: []string{"order_id"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIncremental(&Model{Parsed: stmt, Incremental: tt.incremental})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetIncrementalCursors(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// ddbExec opens ./preenContext.db
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Chdir(wd)
+	if err = ddbExec("select 1"); err != nil {
+		t.Skipf("duckdb extensions unavailable: %v", err)
+	}
+
+	model := &Model{Name: "orders", Incremental: &Incremental{CursorColumn: "updated_at"}}
+	if err = ddbExec(fmt.Sprintf(
+		`create table %s (model_name varchar, source_name varchar, cursor_value varchar, updated_at timestamp, cursor_type varchar);
+		insert into %[1]s values
+			('orders', 'eu', '2024-03-05 10:20:30', now(), 'TIMESTAMP'),
+			('orders', 'us', null, now(), 'TIMESTAMP'),
+			('orders', 'ap', '0/16B3748', now(), null),
+			('users', 'eu', '42', now(), 'BIGINT');`,
+		incrementalCursorsTable,
+	)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cursors, err := getIncrementalCursors(model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]incrementalCursor{
+		"eu": {"2024-03-05 10:20:30", "TIMESTAMP"},
+		"ap": {"0/16B3748", ""},
+	}
+	if !reflect.DeepEqual(cursors, expected) {
+		t.Errorf("getIncrementalCursors() = %v; want %v", cursors, expected)
+	}
+}
+
+func TestBuildIncrementalTables(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// ddbExec opens ./preenContext.db
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Chdir(wd)
+	if err = ddbExec("select 1"); err != nil {
+		t.Skipf("duckdb extensions unavailable: %v", err)
+	}
+
+	model := &Model{
+		Name:        "orders",
+		DDLString:   "preen_source_name varchar, id bigint, updated_at timestamp",
+		Incremental: &Incremental{CursorColumn: "updated_at", UniqueKey: []string{"id"}},
+	}
+	if err = buildIncrementalTables(model, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = ddbExec("insert into main.orders_preen_staging values ('eu', 1, '2024-03-05 10:20:30')"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = mergeIncrementalModel(model, "orders"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cursors, err := getIncrementalCursors(model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (incrementalCursor{"2024-03-05 10:20:30", "TIMESTAMP"}); cursors["eu"] != expected {
+		t.Errorf("getIncrementalCursors() = %v; want %v", cursors["eu"], expected)
+	}
+
+	if err = buildIncrementalTables(model, false); err != nil {
+		t.Errorf("unexpected error rebuilding unchanged model: %v", err)
+	}
+
+	model.DDLString = "preen_source_name varchar, id varchar, updated_at timestamp"
+	if err = buildIncrementalTables(model, false); err == nil {
+		t.Errorf("expected error for changed columns, got nil")
+	}
+	if err = buildIncrementalTables(model, true); err != nil {
+		t.Fatalf("unexpected error on full refresh: %v", err)
+	}
+	if cursors, err = getIncrementalCursors(model); err != nil || len(cursors) != 0 {
+		t.Errorf("getIncrementalCursors() after full refresh = %v, %v; want no cursors", cursors, err)
+	}
+}
@@ -5,7 +5,26 @@ import (
 	"fmt"
 )
 
-func Insert(modelName ModelName, ic <-chan []driver.Value, dc chan<- []int64) {
+// insertResult is sent by Insert once the rows are appended. failure holds the panic that stopped the insert.
+type insertResult struct {
+	rows    int64
+	failure any
+}
+
+// Insert appends the rows sent on ic to the model table until a quit message, and sends the result on dc.
+// If appending fails, the remaining rows are drained so senders don't block, and the failure is raised
+// again by ConfirmInsert in the goroutine waiting for the insert.
+func Insert(modelName ModelName, ic <-chan []driver.Value, dc chan<- insertResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			for message := range ic {
+				if message[0] == "quit" {
+					break
+				}
+			}
+			dc <- insertResult{failure: r}
+		}
+	}()
 	connector, err := ddbCreateConnector()
 	if err != nil {
 		panic(err)
@@ -39,22 +58,20 @@ func Insert(modelName ModelName, ic <-chan []driver.Value, dc chan<- []int64) {
 	if err = appender.Close(); err != nil {
 		panic(err)
 	}
-	dc <- []int64{int64(rowCounter)}
+	dc <- insertResult{rows: int64(rowCounter)}
 }
 
-func ConfirmInsert(modelName string, dc chan []int64, rowsExpected int64) {
-	for message := range dc {
-		if rowsExpected == 0 {
-			Debug(fmt.Sprintf("Inserted %d rows into model %s", message[0], modelName))
-			break
-		}
-		if message[0] == rowsExpected {
-			Debug(fmt.Sprintf("Inserted %d rows into model %s. Expected %d rows", message[0], modelName, rowsExpected))
-			break
-		}
-		if message[0] != rowsExpected {
-			Error(fmt.Sprintf("Inserted %d rows into model %s. Expected %d rows", message[0], modelName, rowsExpected))
-			break
-		}
+func ConfirmInsert(modelName string, dc chan insertResult, rowsExpected int64) {
+	result := <-dc
+	if result.failure != nil {
+		panic(result.failure)
+	}
+	switch {
+	case rowsExpected == 0:
+		Debug(fmt.Sprintf("Inserted %d rows into model %s", result.rows, modelName))
+	case result.rows == rowsExpected:
+		Debug(fmt.Sprintf("Inserted %d rows into model %s. Expected %d rows", result.rows, modelName, rowsExpected))
+	default:
+		Error(fmt.Sprintf("Inserted %d rows into model %s. Expected %d rows", result.rows, modelName, rowsExpected))
 	}
 }
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+)
+
+// localEngine loads file models from a base directory on disk through the native duckDB readers.
+// Like the s3 engine, rows are never sent to the insert channel.
+type localEngine struct {
+	source Source
+}
+
+func init() {
+	RegisterSourceEngine("local", newLocalEngine)
+}
+
+func newLocalEngine(source Source) SourceEngine {
+	return &localEngine{source: source}
+}
+
+// Connect confirms that the base directory of the source exists.
+func (e *localEngine) Connect() error {
+	if e.source.Connection.Path == "" {
+		return fmt.Errorf("path required for local source %s", e.source.Name)
+	}
+	info, err := os.Stat(e.source.Connection.Path)
+	if err != nil {
+		return fmt.Errorf("error accessing path %s: %w", e.source.Connection.Path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("path %s is not a directory", e.source.Connection.Path)
+	}
+	return nil
+}
+
+// DescribeColumns is a no-op, duckDB infers the column types of file models.
+func (e *localEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	return nil
+}
+
+func (e *localEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	return ingestFileSource(r, "")
+}
+
+func (e *localEngine) Close() error {
+	return nil
+}
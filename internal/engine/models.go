@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -49,24 +50,90 @@ type Options struct {
 	UnionByName        *bool     `default:"false" yaml:"union_by_name"`
 }
 
+// ParquetOptions are the options of parquet file models.
+// https://duckdb.org/docs/data/parquet/overview.html#parameters
+type ParquetOptions struct {
+	BinaryAsString   *bool `default:"false" yaml:"binary_as_string"`
+	FileName         *bool `default:"false" yaml:"filename"`
+	FileRowNumber    *bool `default:"false" yaml:"file_row_number"`
+	HivePartitioning *bool `default:"false" yaml:"hive_partitioning"`
+	UnionByName      *bool `default:"false" yaml:"union_by_name"`
+}
+
+// JSONOptions are the options of json and ndjson file models.
+// https://duckdb.org/docs/data/json/loading_json#parameters
+type JSONOptions struct {
+	AutoDetect               *bool   `default:"true" yaml:"auto_detect"`
+	Columns                  *[]Type `default:"-" yaml:"columns"`
+	Compression              *string `default:"-" yaml:"compression"`
+	ConvertStringsToIntegers *bool   `default:"false" yaml:"convert_strings_to_integers"`
+	DateFormat               *string `default:"-" yaml:"dateformat"`
+	FileName                 *bool   `default:"false" yaml:"filename"`
+	Format                   *string `default:"-" yaml:"format"`
+	HivePartitioning         *bool   `default:"false" yaml:"hive_partitioning"`
+	IgnoreErrors             *bool   `default:"false" yaml:"ignore_errors"`
+	MaximumDepth             *int64  `default:"-1" yaml:"maximum_depth"`
+	MaximumObjectSize        *int64  `default:"16777216" yaml:"maximum_object_size"`
+	Records                  *string `default:"-" yaml:"records"`
+	SampleSize               *int64  `default:"20480" yaml:"sample_size"`
+	TimestampFormat          *string `default:"-" yaml:"timestampformat"`
+	UnionByName              *bool   `default:"false" yaml:"union_by_name"`
+}
+
+// FailurePolicy controls how a model build reacts to sources that fail during retrieval.
+// Mode is one of fail_fast (the default), continue or threshold. In threshold mode the
+// build keeps going until more than MaxFailures sources have failed.
+type FailurePolicy struct {
+	Mode        string `yaml:"mode"`
+	MaxFailures int    `yaml:"max_failures"`
+}
+
 type Model struct {
-	Name         ModelName `yaml:"name"`
-	Type         string    `yaml:"type"`
-	Format       string    `yaml:"format"`
-	Options      Options   `yaml:"options"`
-	Query        string    `yaml:"query"`
-	FilePatterns *[]string `yaml:"file_patterns"`
-	Collection   string    `yaml:"collection"`
-	Parsed       sqlparser.Statement
-	DDLString    string
-	Columns      map[TableName]map[ColumnName]Column
-	TableMap     TableMap
-	TableSet     TableSet
+	Name          ModelName       `yaml:"name"`
+	Type          string          `yaml:"type"`
+	Format        string          `yaml:"format"`
+	Options       Options         `yaml:"options"`
+	Query         string          `yaml:"query"`
+	FilePatterns  *[]string       `yaml:"file_patterns"`
+	Collection    string          `yaml:"collection"`
+	Pipeline      string          `yaml:"pipeline"`
+	Projection    string          `yaml:"projection"`
+	Fields        []DocumentField `yaml:"fields"`
+	FailurePolicy FailurePolicy   `yaml:"failure_policy"`
+	Incremental   *Incremental    `yaml:"incremental"`
+	CDC           *CDC            `yaml:"cdc"`
+	Tests         []ModelTest     `yaml:"tests"`
+	// ParquetOptions and JSONOptions are decoded from the options of parquet and json file models
+	ParquetOptions ParquetOptions `yaml:"-"`
+	JSONOptions    JSONOptions    `yaml:"-"`
+	Parsed         sqlparser.Statement
+	DDLString      string
+	Columns        map[TableName]map[ColumnName]Column
+	TableMap       TableMap
+	TableSet       TableSet
+	// rawOptions keeps the options node, since the option set of a file model depends on its format
+	rawOptions *yaml.Node
+}
+
+// UnmarshalYAML decodes the model and keeps its raw options for parseFileOptions.
+func (m *Model) UnmarshalYAML(value *yaml.Node) error {
+	type rawModel Model
+	if err := value.Decode((*rawModel)(m)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value == "options" {
+			m.rawOptions = value.Content[i+1]
+		}
+	}
+	return nil
 }
 
 type ModelConfig struct {
 	Models []*Model `yaml:"models"`
 	Env    *Env     `yaml:"-"`
+	// FullRefresh rebuilds incremental models from scratch, ignoring stored cursors.
+	FullRefresh bool `yaml:"-"`
 }
 
 // Models can be defined in a models.yaml file in the preen config directory.
@@ -92,8 +159,14 @@ func GetModelConfigs(modelTarget string) (*ModelConfig, error) {
 		}
 	}
 
+	// Graph targets such as +orders+ select models by their dependencies, so every model file is parsed
+	fileTarget := modelTarget
+	if isGraphTarget(modelTarget) {
+		fileTarget = ""
+	}
+
 	// Process any .yaml files in the models directory
-	err = parseModelDirectoryFiles(modelsDir, modelTarget, &mc)
+	err = parseModelDirectoryFiles(modelsDir, fileTarget, &mc)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing models directory: %w", err)
 	}
@@ -116,11 +189,21 @@ func GetModelConfigs(modelTarget string) (*ModelConfig, error) {
 		return nil, fmt.Errorf("error parsing model tables: %w", err)
 	}
 
+	if isGraphTarget(modelTarget) {
+		if err = selectModelGraph(&mc, modelTarget); err != nil {
+			return nil, fmt.Errorf("error selecting target models: %w", err)
+		}
+	}
+
 	return &mc, nil
 }
 
 // This is the main entry point for building models. The CLI commands call this function.
 func BuildModels(sc *SourceConfig, mc *ModelConfig) error {
+	// The metadata and every model connect to the sources separately, their ssh tunnels stay open for the whole build
+	holdSSHTunnels()
+	defer releaseSSHTunnels()
+
 	if err := BuildMetadata(sc, mc); err != nil {
 		return fmt.Errorf("error building information schema: %w", err)
 	}
@@ -147,6 +230,10 @@ func BuildModels(sc *SourceConfig, mc *ModelConfig) error {
 		return fmt.Errorf("error retrieving data: %w", err)
 	}
 
+	if err = buildTransformModels(mc); err != nil {
+		return fmt.Errorf("error building transform models: %w", err)
+	}
+
 	return nil
 }
 
@@ -211,12 +298,19 @@ func parseModelDirectoryFiles(modelsDir string, modelTarget string, mc *ModelCon
 // Parse the models and create a parsed version of the model's required fields.
 // This is where the SQL models are parsed into ASTs.
 // This is where the file models are validated.
+// Transform models run inside DuckDB, their query is parsed to infer their dependencies.
 func parseModels(mc *ModelConfig) error {
 	for modelName, model := range mc.Models {
+		if err := validateFailurePolicy(&model.FailurePolicy); err != nil {
+			return fmt.Errorf("error parsing model %v: %w", modelName, err)
+		}
+		if err := validateModelTests(model); err != nil {
+			return fmt.Errorf("error parsing tests for model %v: %w", modelName, err)
+		}
 		switch model.Type {
 		case "database":
-			// Database models require a query
-			if model.Query == "" {
+			// Database models require a query, MongoDB models can use an aggregation pipeline instead
+			if model.Query == "" && model.Pipeline == "" {
 				return fmt.Errorf("error parsing database model %v: query required", modelName)
 			}
 			// If the query is a SELECT statement, parse it
@@ -227,25 +321,118 @@ func parseModels(mc *ModelConfig) error {
 				}
 				model.Parsed = stmt
 				mc.Models[modelName] = model
+				if err = validateIncremental(model); err != nil {
+					return fmt.Errorf("error parsing incremental model %v: %w", modelName, err)
+				}
+				if err = validateCDC(model); err != nil {
+					return fmt.Errorf("error parsing cdc model %v: %w", modelName, err)
+				}
 				// If the query is not a SELECT statement, set the parsed statement to nil
 			} else {
 				model.Parsed = nil
 				mc.Models[modelName] = model
+				if model.Incremental != nil || model.CDC != nil {
+					return fmt.Errorf("error parsing database model %v: incremental and cdc builds require a SQL query", modelName)
+				}
+				if err := validateDocumentModel(model); err != nil {
+					return fmt.Errorf("error parsing document model %v: %w", modelName, err)
+				}
 			}
 		case "file":
 			if model.FilePatterns == nil {
 				return fmt.Errorf("error parsing file model %v: file_pattern required", modelName)
 			}
+			if model.Incremental != nil || model.CDC != nil {
+				return fmt.Errorf("error parsing file model %v: incremental and cdc builds are only supported for database models", modelName)
+			}
+			if err := parseFileOptions(model); err != nil {
+				return fmt.Errorf("error parsing file model %v: %w", modelName, err)
+			}
+		case "transform":
+			if model.Query == "" {
+				return fmt.Errorf("error parsing transform model %v: query required", modelName)
+			}
+			if model.Incremental != nil || model.CDC != nil {
+				return fmt.Errorf("error parsing transform model %v: incremental and cdc builds are only supported for database models", modelName)
+			}
+			stmt, err := sqlparser.Parse(model.Query)
+			if err != nil {
+				return fmt.Errorf("error parsing transform model %v: %w", modelName, err)
+			}
+			model.Parsed = stmt
 		}
 	}
 	return nil
 }
 
+// parseFileOptions decodes the options of a file model into the option set of its format.
+// Unknown options are rejected, and the enumerated option values are checked.
+func parseFileOptions(model *Model) error {
+	switch model.Format {
+	case "csv":
+		return decodeFileOptions(model.rawOptions, &model.Options)
+	case "parquet":
+		return decodeFileOptions(model.rawOptions, &model.ParquetOptions)
+	case "json", "ndjson":
+		if err := decodeFileOptions(model.rawOptions, &model.JSONOptions); err != nil {
+			return err
+		}
+		o := model.JSONOptions
+		if o.Format != nil {
+			if !slices.Contains([]string{"auto", "unstructured", "newline_delimited", "array"}, *o.Format) {
+				return fmt.Errorf("invalid json format %s: must be auto, unstructured, newline_delimited or array", *o.Format)
+			}
+			if model.Format == "ndjson" && *o.Format != "newline_delimited" {
+				return fmt.Errorf("invalid json format %s: ndjson files are newline_delimited", *o.Format)
+			}
+		}
+		if o.Records != nil && !slices.Contains([]string{"auto", "true", "false"}, *o.Records) {
+			return fmt.Errorf("invalid json records %s: must be auto, true or false", *o.Records)
+		}
+		if o.Compression != nil && !slices.Contains([]string{"auto_detect", "none", "gzip", "zstd"}, *o.Compression) {
+			return fmt.Errorf("invalid compression %s: must be auto_detect, none, gzip or zstd", *o.Compression)
+		}
+		return nil
+	case "":
+		return fmt.Errorf("format required")
+	default:
+		return fmt.Errorf("unsupported file format %s: must be csv, parquet, json or ndjson", model.Format)
+	}
+}
+
+func decodeFileOptions(node *yaml.Node, options any) error {
+	if node == nil {
+		return nil
+	}
+	raw, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(options); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
+
 // Create each model's destination table in DuckDB
 func buildDuckDBTables(mc *ModelConfig) error {
 	for _, model := range mc.Models {
 		switch model.Type {
 		case "database":
+			if model.Incremental != nil {
+				if err := buildIncrementalTables(model, mc.FullRefresh); err != nil {
+					return err
+				}
+				continue
+			}
+			if model.CDC != nil {
+				if err := buildCDCTables(model, mc.FullRefresh); err != nil {
+					return err
+				}
+				continue
+			}
 			Debug(fmt.Sprintf("Creating table %s", model.Name))
 			tableName := strings.ReplaceAll(string(model.Name), "-", "_")
 			createTableStmt := fmt.Sprintf("create or replace table main.%s (%s);", tableName, model.DDLString)
@@ -253,7 +440,13 @@ func buildDuckDBTables(mc *ModelConfig) error {
 				return fmt.Errorf("error creating table %s: %w", tableName, err)
 			}
 		case "file":
-			Debug("Tables for file models will be created on model retrieval")
+			// The table is created by the first source on model retrieval, with the columns of its files
+			tableName := strings.ReplaceAll(string(model.Name), "-", "_")
+			if err := ddbExec(fmt.Sprintf("drop table if exists main.%s;", tableName)); err != nil {
+				return fmt.Errorf("error dropping table %s: %w", tableName, err)
+			}
+		case "transform":
+			Debug("Tables for transform models will be created after model retrieval")
 		}
 	}
 	return nil
@@ -283,6 +476,7 @@ func errorOnMissingModels(sc *SourceConfig, mc *ModelConfig) error {
 }
 
 // Remove unused models from ModelConfig. If a model is not referenced in any source, it is unused.
+// Transform models read from other models instead of sources, so they are never unused.
 func removeUnusedModels(sc *SourceConfig, mc *ModelConfig) error {
 	usedModels := make([]string, 0)
 	for _, source := range sc.Sources {
@@ -291,12 +485,58 @@ func removeUnusedModels(sc *SourceConfig, mc *ModelConfig) error {
 		}
 	}
 
-	for i, model := range mc.Models {
-		if !slices.Contains(usedModels, string(model.Name)) {
+	models := make([]*Model, 0, len(mc.Models))
+	for _, model := range mc.Models {
+		if model.Type != "transform" && !slices.Contains(usedModels, string(model.Name)) {
 			Info(fmt.Sprintf("Removing unused model: %s", model.Name))
-			mc.Models = append(mc.Models[:i], mc.Models[i+1:]...)
+			continue
 		}
+		models = append(models, model)
 	}
+	mc.Models = models
 
 	return nil
 }
+
+// Validate the model's failure policy and default the mode to fail_fast.
+func validateFailurePolicy(fp *FailurePolicy) error {
+	switch fp.Mode {
+	case "":
+		fp.Mode = "fail_fast"
+	case "fail_fast", "continue":
+	case "threshold":
+		if fp.MaxFailures < 1 {
+			return fmt.Errorf("failure_policy threshold mode requires max_failures of at least 1")
+		}
+	default:
+		return fmt.Errorf("unsupported failure_policy mode %s. allowed values are fail_fast, continue, threshold", fp.Mode)
+	}
+	return nil
+}
+
+// failureLimitExceeded reports whether the number of failed sources breaks the model's failure policy.
+func (fp FailurePolicy) failureLimitExceeded(failures int) bool {
+	switch fp.Mode {
+	case "continue":
+		return false
+	case "threshold":
+		return failures > fp.MaxFailures
+	default:
+		return failures > 0
+	}
+}
+
+// failureError returns the error that stops a model build once its failed sources break the failure
+// policy, or nil while the build can continue.
+func (fp FailurePolicy) failureError(modelName ModelName, failures []SourceResult) error {
+	if !fp.failureLimitExceeded(len(failures)) {
+		return nil
+	}
+	if fp.Mode == "threshold" {
+		return fmt.Errorf(
+			"%d sources failed for model %s, exceeding the failure policy limit of %d",
+			len(failures), modelName, fp.MaxFailures,
+		)
+	}
+	return fmt.Errorf("source %s failed for model %s: %w", failures[0].SourceName, modelName, failures[0].Err)
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestValidateFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       FailurePolicy
+		expectedMode string
+		expectError  bool
+	}{
+		{"default", FailurePolicy{}, "fail_fast", false},
+		{"fail_fast", FailurePolicy{Mode: "fail_fast"}, "fail_fast", false},
+		{"continue", FailurePolicy{Mode: "continue"}, "continue", false},
+		{"threshold", FailurePolicy{Mode: "threshold", MaxFailures: 2}, "threshold", false},
+		{"threshold without max_failures", FailurePolicy{Mode: "threshold"}, "threshold", true},
+		{"unsupported", FailurePolicy{Mode: "retry"}, "retry", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFailurePolicy(&tt.policy)
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.policy.Mode != tt.expectedMode {
+				t.Errorf("expected mode %s, got %s", tt.expectedMode, tt.policy.Mode)
+			}
+		})
+	}
+}
+
+func TestFailureLimitExceeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   FailurePolicy
+		failures int
+		expected bool
+	}{
+		{"fail_fast with no failures", FailurePolicy{Mode: "fail_fast"}, 0, false},
+		{"fail_fast with one failure", FailurePolicy{Mode: "fail_fast"}, 1, true},
+		{"continue with failures", FailurePolicy{Mode: "continue"}, 198, false},
+		{"threshold at limit", FailurePolicy{Mode: "threshold", MaxFailures: 2}, 2, false},
+		{"threshold over limit", FailurePolicy{Mode: "threshold", MaxFailures: 2}, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.policy.failureLimitExceeded(tt.failures); result != tt.expected {
+				t.Errorf("failureLimitExceeded(%d) = %v; want %v", tt.failures, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFailureError(t *testing.T) {
+	failures := []SourceResult{
+		{ModelName: "users", SourceName: "eu", Err: errors.New("connection refused")},
+		{ModelName: "users", SourceName: "us", Err: errors.New("timeout")},
+	}
+	tests := []struct {
+		name     string
+		policy   FailurePolicy
+		failures []SourceResult
+		expected string
+	}{
+		{"fail_fast", FailurePolicy{Mode: "fail_fast"}, failures[:1], "source eu failed for model users: connection refused"},
+		{"continue", FailurePolicy{Mode: "continue"}, failures, ""},
+		{"threshold at limit", FailurePolicy{Mode: "threshold", MaxFailures: 2}, failures, ""},
+		{"threshold over limit", FailurePolicy{Mode: "threshold", MaxFailures: 1}, failures, "2 sources failed for model users, exceeding the failure policy limit of 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.failureError("users", tt.failures)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("failureError() = %v; want %s", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFileOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		model       string
+		expected    string
+		expectError bool
+	}{
+		{
+			"parquet",
+			"format: parquet\noptions:\n  hive_partitioning: true\n",
+			"read_parquet(['s3://lake/events/*.parquet'],binary_as_string = false, filename = false, file_row_number = false, hive_partitioning = true, union_by_name = false)",
+			false,
+		},
+		{
+			"json records",
+			"format: json\noptions:\n  format: array\n  records: 'false'\n  filename: true\n",
+			"read_json(['s3://lake/events/*.parquet'],auto_detect = true, convert_strings_to_integers = false, filename = true, format = 'array', hive_partitioning = false, ignore_errors = false, maximum_depth = -1, maximum_object_size = 16777216, records = 'false', sample_size = 20480, union_by_name = false)",
+			false,
+		},
+		{"csv option on parquet", "format: parquet\noptions:\n  delim: ','\n", "", true},
+		{"invalid json format", "format: json\noptions:\n  format: csv\n", "", true},
+		{"ndjson is newline delimited", "format: ndjson\noptions:\n  format: array\n", "", true},
+		{"invalid records", "format: ndjson\noptions:\n  records: maybe\n", "", true},
+		{"unsupported format", "format: xlsx\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := Model{}
+			if err := yaml.Unmarshal([]byte(tt.model), &model); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err := parseFileOptions(&model)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r := &Retriever{
+				Source:         Source{Engine: "s3", Connection: Connection{BucketName: "lake"}},
+				Format:         model.Format,
+				FilePatterns:   &[]string{"events/*.parquet"},
+				ParquetOptions: model.ParquetOptions,
+				JSONOptions:    model.JSONOptions,
+			}
+			result, err := fileReader(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("fileReader() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
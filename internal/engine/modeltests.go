@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ModelTest is a data quality assertion on a built model table. Each test compiles to a
+// DuckDB query that returns the rows violating the assertion.
+// Supported types are not_null, unique, accepted_values and row_count. With per_source, unique
+// and row_count are evaluated separately for every preen_source_name.
+type ModelTest struct {
+	Type      string   `yaml:"type"`
+	Column    string   `yaml:"column"`
+	Values    []string `yaml:"values"`
+	Min       *int64   `yaml:"min"`
+	Max       *int64   `yaml:"max"`
+	PerSource bool     `yaml:"per_source"`
+}
+
+// ModelTestResult is the outcome of running a single test against a model table.
+type ModelTestResult struct {
+	ModelName   ModelName
+	TestName    string
+	FailingRows int64
+	Samples     *QueryResults
+}
+
+const modelTestSampleSize = 5
+
+// Name identifies the test in reports, e.g. not_null(user_id).
+func (mt ModelTest) Name() string {
+	if mt.Column == "" {
+		return mt.Type
+	}
+	return fmt.Sprintf("%s(%s)", mt.Type, mt.Column)
+}
+
+// validateModelTests checks that every test has the options its type requires.
+func validateModelTests(model *Model) error {
+	for _, test := range model.Tests {
+		switch test.Type {
+		case "not_null", "unique":
+			if test.Column == "" {
+				return fmt.Errorf("%s test requires a column", test.Type)
+			}
+		case "accepted_values":
+			if test.Column == "" || len(test.Values) == 0 {
+				return fmt.Errorf("accepted_values test requires a column and values")
+			}
+		case "row_count":
+			if test.Min == nil && test.Max == nil {
+				return fmt.Errorf("row_count test requires min or max")
+			}
+		default:
+			return fmt.Errorf("unsupported test type %s. allowed values are not_null, unique, accepted_values, row_count", test.Type)
+		}
+	}
+	return nil
+}
+
+// compileModelTest returns the query selecting the rows of the model table that fail the test.
+// sourceNames are the sources configured for the model, which per source row counts are reported
+// for even when a source retrieved no rows.
+func compileModelTest(tableName string, test ModelTest, sourceNames []string) string {
+	switch test.Type {
+	case "not_null":
+		return fmt.Sprintf("select * from main.%s where %s is null", tableName, test.Column)
+	case "unique":
+		groupBy := test.Column
+		if test.PerSource {
+			groupBy = "preen_source_name, " + test.Column
+		}
+		return fmt.Sprintf(
+			"select %s, count(*) as preen_count from main.%s where %s is not null group by %s having count(*) > 1",
+			groupBy, tableName, test.Column, groupBy,
+		)
+	case "accepted_values":
+		values := make([]string, len(test.Values))
+		for i, value := range test.Values {
+			values[i] = fmt.Sprintf("'%s'", strings.ReplaceAll(value, "'", "''"))
+		}
+		return fmt.Sprintf(
+			"select * from main.%s where %s is not null and %s::varchar not in (%s)",
+			tableName, test.Column, test.Column, strings.Join(values, ", "),
+		)
+	case "row_count":
+		rowCount := "count(*)"
+		if test.PerSource && len(sourceNames) > 0 {
+			rowCount = "coalesce(counts.row_count, 0)"
+		}
+		conditions := make([]string, 0)
+		if test.Min != nil {
+			conditions = append(conditions, fmt.Sprintf("%s < %d", rowCount, *test.Min))
+		}
+		if test.Max != nil {
+			conditions = append(conditions, fmt.Sprintf("%s > %d", rowCount, *test.Max))
+		}
+		if test.PerSource && len(sourceNames) > 0 {
+			names := make([]string, len(sourceNames))
+			for i, name := range sourceNames {
+				names[i] = fmt.Sprintf("('%s')", strings.ReplaceAll(name, "'", "''"))
+			}
+			return fmt.Sprintf(
+				"select sources.preen_source_name, %s as row_count from (values %s) as sources(preen_source_name) "+
+					"left join (select preen_source_name, count(*) as row_count from main.%s group by preen_source_name) as counts "+
+					"on counts.preen_source_name = sources.preen_source_name where %s",
+				rowCount, strings.Join(names, ", "), tableName, strings.Join(conditions, " or "),
+			)
+		}
+		if test.PerSource {
+			return fmt.Sprintf(
+				"select preen_source_name, count(*) as row_count from main.%s group by preen_source_name having %s",
+				tableName, strings.Join(conditions, " or "),
+			)
+		}
+		return fmt.Sprintf(
+			"select count(*) as row_count from main.%s having %s",
+			tableName, strings.Join(conditions, " or "),
+		)
+	}
+	return ""
+}
+
+// RunModelTests runs the tests of every model against the built DuckDB tables.
+// It returns an error if any test fails, so the CLI exits non-zero.
+func RunModelTests(sc *SourceConfig, mc *ModelConfig) error {
+	results := make([]ModelTestResult, 0)
+	for _, model := range mc.Models {
+		tableName := modelTableName(model.Name)
+		sourceNames := make([]string, 0)
+		for _, source := range sc.Sources {
+			if slices.Contains(source.Models, string(model.Name)) {
+				sourceNames = append(sourceNames, source.Name)
+			}
+		}
+		for _, test := range model.Tests {
+			Debug(fmt.Sprintf("Running test %s on model %s", test.Name(), model.Name))
+			result, err := runModelTest(tableName, test, sourceNames)
+			if err != nil {
+				return fmt.Errorf("error running test %s on model %s: %w", test.Name(), model.Name, err)
+			}
+			result.ModelName = model.Name
+			results = append(results, *result)
+		}
+	}
+
+	if len(results) == 0 {
+		Info("No model tests configured")
+		return nil
+	}
+
+	return reportModelTests(results)
+}
+
+func runModelTest(tableName string, test ModelTest, sourceNames []string) (*ModelTestResult, error) {
+	query := compileModelTest(tableName, test, sourceNames)
+	count, err := Execute(fmt.Sprintf("select count(*) as failing_rows from (%s)", query))
+	if err != nil {
+		return nil, err
+	}
+	result := ModelTestResult{TestName: test.Name()}
+	if len(count.Rows) > 0 {
+		if failingRows, ok := count.Rows[0]["failing_rows"].(int64); ok {
+			result.FailingRows = failingRows
+		}
+	}
+	if result.FailingRows > 0 {
+		if result.Samples, err = Execute(fmt.Sprintf("%s limit %d", query, modelTestSampleSize)); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+func reportModelTests(results []ModelTestResult) error {
+	failures := 0
+	rows := make([]map[string]any, len(results))
+	for i, result := range results {
+		status := "pass"
+		if result.FailingRows > 0 {
+			status = "fail"
+			failures++
+		}
+		rows[i] = map[string]any{
+			"model_name":   result.ModelName,
+			"test":         result.TestName,
+			"status":       status,
+			"failing_rows": result.FailingRows,
+		}
+	}
+	if err := WriteToTable(rows, []string{"model_name", "test", "status", "failing_rows"}, "table"); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.FailingRows == 0 || result.Samples == nil {
+			continue
+		}
+		fmt.Printf("\nSample failing rows for %s on model %s:\n", result.TestName, result.ModelName)
+		if err := WriteToTable(result.Samples.Rows, result.Samples.Columns, "table"); err != nil {
+			return err
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d model tests failed", failures, len(results))
+	}
+	Info(fmt.Sprintf("All %d model tests passed", len(results)))
+	return nil
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestCompileModelTest(t *testing.T) {
+	min := int64(1)
+	tests := []struct {
+		name     string
+		test     ModelTest
+		expected string
+	}{
+		{
+			"not_null",
+			ModelTest{Type: "not_null", Column: "id"},
+			"select * from main.users where id is null",
+		},
+		{
+			"unique per source",
+			ModelTest{Type: "unique", Column: "id", PerSource: true},
+			"select preen_source_name, id, count(*) as preen_count from main.users where id is not null group by preen_source_name, id having count(*) > 1",
+		},
+		{
+			"accepted_values",
+			ModelTest{Type: "accepted_values", Column: "status", Values: []string{"active", "won't"}},
+			"select * from main.users where status is not null and status::varchar not in ('active', 'won''t')",
+		},
+		{
+			"row_count per source",
+			ModelTest{Type: "row_count", Min: &min, PerSource: true},
+			"select preen_source_name, count(*) as row_count from main.users group by preen_source_name having count(*) < 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := compileModelTest("users", tt.test, nil); result != tt.expected {
+				t.Errorf("compileModelTest() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompileModelTestEmptySource(t *testing.T) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("create table main.users (preen_source_name varchar, id int)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = db.Exec("insert into main.users values ('us', 1), ('us', 2), ('eu', 3)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// o'hare retrieved no rows, so it has no group in the model table
+	min := int64(2)
+	query := compileModelTest("users", ModelTest{Type: "row_count", Min: &min, PerSource: true}, []string{"us", "eu", "o'hare"})
+	rows, err := db.Query(query + " order by 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+	failing := make(map[string]int64)
+	for rows.Next() {
+		var sourceName string
+		var rowCount int64
+		if err = rows.Scan(&sourceName, &rowCount); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		failing[sourceName] = rowCount
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]int64{"eu": 1, "o'hare": 0}
+	if !reflect.DeepEqual(failing, expected) {
+		t.Errorf("failing sources = %v; want %v", failing, expected)
+	}
+}
+
+func TestValidateModelTests(t *testing.T) {
+	tests := []struct {
+		name        string
+		test        ModelTest
+		expectError bool
+	}{
+		{"valid not_null", ModelTest{Type: "not_null", Column: "id"}, false},
+		{"not_null without column", ModelTest{Type: "not_null"}, true},
+		{"accepted_values without values", ModelTest{Type: "accepted_values", Column: "status"}, true},
+		{"row_count without bounds", ModelTest{Type: "row_count"}, true},
+		{"unsupported type", ModelTest{Type: "foreign_key", Column: "id"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateModelTests(&Model{Tests: []ModelTest{tt.test}})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -5,18 +5,28 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/marcboeker/go-duckdb"
+
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func mongoConnFromSource(source Source, ctx context.Context) (*mongo.Client, error) {
-
-	url := fmt.Sprintf(
+// mongoURI returns the uri of a source, or builds one from its connection fields and options.
+func mongoURI(source Source) string {
+	if source.Connection.URI != "" {
+		return source.Connection.URI
+	}
+	uri := fmt.Sprintf(
 		"mongodb://%s:%s@%s:%d/?authSource=%s",
 		source.Connection.Username,
 		url.QueryEscape(source.Connection.Password),
@@ -24,8 +34,27 @@ func mongoConnFromSource(source Source, ctx context.Context) (*mongo.Client, err
 		source.Connection.Port,
 		source.Connection.AuthSource,
 	)
+	if options := connectionOptions(source); len(options) > 0 {
+		uri += "&" + options.Encode()
+	}
+	return uri
+}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+func mongoConnFromSource(source Source, ctx context.Context) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(mongoURI(source))
+	tlsConf, err := tlsConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		clientOptions.SetTLSConfig(tlsConf)
+	}
+	// The replica set members' addresses are not reachable outside the tunnel
+	if source.SSHTunnel != nil {
+		clientOptions.SetDirect(true)
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -35,28 +64,104 @@ func mongoConnFromSource(source Source, ctx context.Context) (*mongo.Client, err
 	return client, nil
 }
 
-func ingestMongoModel(r *Retriever, ic chan []driver.Value) error {
-	Debug(fmt.Sprintf("Retrieving context %s for %s", r.ModelName, r.Source.Name))
+type mongoEngine struct {
+	source Source
+	client *mongo.Client
+}
+
+func init() {
+	RegisterSourceEngine("mongodb", newMongoEngine)
+}
+
+func newMongoEngine(source Source) SourceEngine {
+	return &mongoEngine{source: source}
+}
+
+func (e *mongoEngine) Connect() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	mongoClient, err := mongoConnFromSource(r.Source, ctx)
+	client, err := mongoConnFromSource(e.source, ctx)
 	if err != nil {
 		return err
 	}
+	e.client = client
+	return nil
+}
 
-	// If this function returns an error, then it failed to disconnect from the mongo client
-	defer func() {
-		if err = mongoClient.Disconnect(context.Background()); err != nil {
-			Errorf("Error disconnecting from mongo: %s", err)
+// DescribeColumns samples the documents of a MongoDB model and stores the BSON type of every field path
+// in the information schema. Models with declared fields describe the paths of their untyped fields,
+// other models describe their top-level fields. The model name is used as the table name since
+// pipelines reshape documents.
+func (e *mongoEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	if model.Type != "database" || model.Parsed != nil {
+		return nil
+	}
+	// Declared types are used as is, only the untyped fields are inferred
+	fields := make([]DocumentField, 0, len(model.Fields))
+	for _, field := range model.Fields {
+		if field.Type == "" {
+			fields = append(fields, field)
 		}
-	}()
+	}
+	if len(model.Fields) > 0 && len(fields) == 0 {
+		Debug(fmt.Sprintf("No fields to infer for %s - %s", e.source.Name, model.Name))
+		return nil
+	}
+	r := &Retriever{
+		ModelName:  string(model.Name),
+		Query:      model.Query,
+		Pipeline:   model.Pipeline,
+		Projection: model.Projection,
+		Collection: model.Collection,
+	}
+	if r.Collection == "" {
+		r.Collection = string(model.Name)
+	}
+	q, err := parseMongoQuery(r)
+	if err != nil {
+		return err
+	}
+	sampleSize := int64(mongoSampleSize)
+	if model.Options.SampleSize != nil && *model.Options.SampleSize > 0 {
+		sampleSize = *model.Options.SampleSize
+	}
 
+	collection := e.client.Database(e.source.Connection.Database).Collection(r.Collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	cur, err := collection.Aggregate(ctx, q.sampleStages(sampleSize))
+	if err != nil {
+		return fmt.Errorf("error sampling mongodb collection %s: %w", r.Collection, err)
+	}
+	defer cur.Close(ctx)
 
-	if err = processMongoDocuments(r, mongoClient, ic); err != nil {
-		return err
+	schema := newDocumentSchema()
+	for cur.Next(ctx) {
+		var document bson.M
+		if err := cur.Decode(&document); err != nil {
+			return fmt.Errorf("error decoding sampled document: %w", err)
+		}
+		schema.observe(document, fields)
 	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("error sampling mongodb collection %s: %w", r.Collection, err)
+	}
+	Debug(fmt.Sprintf("Sampled %d documents for %s - %s", schema.documents, e.source.Name, model.Name))
 
+	for _, path := range schema.paths {
+		ic <- []driver.Value{e.source.Name, string(model.Name), string(model.Name), path, schema.bsonType(path)}
+	}
+	return nil
+}
+
+func (e *mongoEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	return processMongoDocuments(r, e.client, ic)
+}
+
+func (e *mongoEngine) Close() error {
+	if e.client != nil {
+		return e.client.Disconnect(context.Background())
+	}
 	return nil
 }
 
@@ -64,20 +169,9 @@ func processMongoDocuments(r *Retriever, client *mongo.Client, ic chan []driver.
 	collection := client.Database(r.Source.Connection.Database).Collection(r.Collection)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	jsonQuery := make(map[string]interface{})
-	if err := json.Unmarshal([]byte(r.Query), &jsonQuery); err != nil {
-		return fmt.Errorf("Error unmarshalling json query: %s", err)
-	}
-	bsonQuery, err := bson.Marshal(jsonQuery)
-	if err != nil {
-		return fmt.Errorf("Error marshalling json query to BSON: %s", err)
-	}
-	cur, err := collection.Find(ctx, bsonQuery)
+	cur, err := openMongoCursor(ctx, collection, r)
 	if err != nil {
-		return fmt.Errorf("Error executing query: %s", err)
-	}
-	if err := cur.Err(); err != nil {
-		return fmt.Errorf("Error iterating cursor: %s", err)
+		return err
 	}
 	defer cur.Close(ctx)
 	var rowCounter int64
@@ -86,16 +180,493 @@ func processMongoDocuments(r *Retriever, client *mongo.Client, ic chan []driver.
 		if err := cur.Decode(&result); err != nil {
 			return fmt.Errorf("Error decoding result: %s", err)
 		}
-		jsonBytes, err := json.Marshal(result)
+		driverRow, err := documentRow(r, result)
 		if err != nil {
-			return fmt.Errorf("Error marshalling result: %s", err)
+			return err
 		}
 		rowCounter++
-		driverRow := make([]driver.Value, 2)
-		driverRow[0] = r.Source.Name
-		driverRow[1] = string(jsonBytes)
 		ic <- driverRow
 	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("Error iterating cursor: %s", err)
+	}
 	Debug(fmt.Sprintf("Retrieved %d rows for %s - %s\n", rowCounter, r.Source.Name, r.ModelName))
 	return nil
 }
+
+// mongoQuery is the parsed filter, projection and aggregation pipeline of a MongoDB model.
+type mongoQuery struct {
+	filter     bson.M
+	projection bson.M
+	pipeline   []bson.M
+}
+
+func parseMongoQuery(r *Retriever) (*mongoQuery, error) {
+	q := &mongoQuery{filter: bson.M{}}
+	if r.Query != "" {
+		if err := json.Unmarshal([]byte(r.Query), &q.filter); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json query: %s", err)
+		}
+	}
+	if r.Projection != "" {
+		if err := json.Unmarshal([]byte(r.Projection), &q.projection); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json projection: %s", err)
+		}
+	}
+	if r.Pipeline != "" {
+		q.pipeline = make([]bson.M, 0)
+		if err := json.Unmarshal([]byte(r.Pipeline), &q.pipeline); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling json pipeline: %s", err)
+		}
+	}
+	return q, nil
+}
+
+// stages returns the aggregation pipeline with the filter as a leading $match stage
+// and the projection as a trailing $project stage.
+func (q *mongoQuery) stages() []bson.M {
+	stages := make([]bson.M, 0, len(q.pipeline)+2)
+	if len(q.filter) > 0 {
+		stages = append(stages, bson.M{"$match": q.filter})
+	}
+	stages = append(stages, q.pipeline...)
+	if q.projection != nil {
+		stages = append(stages, bson.M{"$project": q.projection})
+	}
+	return stages
+}
+
+// sampleStages returns the stages that sample size documents of the model. Filtered documents
+// are sampled at random, pipelines are cut off after size documents.
+func (q *mongoQuery) sampleStages(size int64) []bson.M {
+	if q.pipeline != nil {
+		return append(q.stages(), bson.M{"$limit": size})
+	}
+	sample := &mongoQuery{filter: q.filter, projection: q.projection, pipeline: []bson.M{{"$sample": bson.M{"size": size}}}}
+	return sample.stages()
+}
+
+// openMongoCursor runs the model's query as a find filter. When the model has an aggregation pipeline,
+// the filter becomes a leading $match stage and the projection a trailing $project stage.
+func openMongoCursor(ctx context.Context, collection *mongo.Collection, r *Retriever) (*mongo.Cursor, error) {
+	q, err := parseMongoQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.pipeline == nil {
+		findOptions := options.Find()
+		if q.projection != nil {
+			findOptions.SetProjection(q.projection)
+		}
+		cur, err := collection.Find(ctx, q.filter, findOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Error executing query: %s", err)
+		}
+		return cur, nil
+	}
+
+	cur, err := collection.Aggregate(ctx, q.stages())
+	if err != nil {
+		return nil, fmt.Errorf("Error executing pipeline: %s", err)
+	}
+	return cur, nil
+}
+
+// DocumentField declares a typed column of a MongoDB model. Path is the dotted path of the value
+// in each document, e.g. address.city, and defaults to the column name. Type is a DuckDB type.
+type DocumentField struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	Type string `yaml:"type"`
+}
+
+// validateDocumentModel checks the pipeline, projection and fields of a MongoDB model.
+// Fields without a name are named after their path, e.g. address.city becomes address_city.
+func validateDocumentModel(model *Model) error {
+	if model.Pipeline != "" {
+		var pipeline []map[string]any
+		if err := json.Unmarshal([]byte(model.Pipeline), &pipeline); err != nil {
+			return fmt.Errorf("pipeline must be a json array of stages: %w", err)
+		}
+	}
+	if model.Projection != "" {
+		var projection map[string]any
+		if err := json.Unmarshal([]byte(model.Projection), &projection); err != nil {
+			return fmt.Errorf("projection must be a json document: %w", err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range model.Fields {
+		field := &model.Fields[i]
+		if field.Path == "" {
+			field.Path = field.Name
+		}
+		if field.Path == "" {
+			return fmt.Errorf("field %d requires a name or path", i)
+		}
+		if field.Name == "" {
+			field.Name = strings.ReplaceAll(field.Path, ".", "_")
+		}
+		if field.Name == "preen_source_name" || names[field.Name] {
+			return fmt.Errorf("duplicate field name %s", field.Name)
+		}
+		names[field.Name] = true
+		// Fields without a type use the type inferred from the sampled documents
+		if field.Type == "" {
+			continue
+		}
+		if _, ok := documentFieldTypes[duckdbTypeMap[strings.ToLower(field.Type)]]; !ok {
+			return fmt.Errorf("unsupported type %s for field %s", field.Type, field.Name)
+		}
+	}
+	return nil
+}
+
+// mongoSampleSize is the number of documents sampled per source when the model sets no sample_size option.
+const mongoSampleSize = 1000
+
+// documentSchema collects the BSON types found at each field path of the sampled documents.
+type documentSchema struct {
+	documents int
+	paths     []string
+	types     map[string]map[string]int
+}
+
+func newDocumentSchema() *documentSchema {
+	return &documentSchema{types: make(map[string]map[string]int)}
+}
+
+// observe records the BSON types of the declared field paths, or of every top-level field
+// when the model declares no fields. Null and missing values are not recorded.
+func (s *documentSchema) observe(document bson.M, fields []DocumentField) {
+	s.documents++
+	if len(fields) > 0 {
+		for _, field := range fields {
+			s.record(field.Path, lookupDocumentPath(document, field.Path))
+		}
+		return
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s.record(key, document[key])
+	}
+}
+
+func (s *documentSchema) record(path string, value any) {
+	bsonType := documentBSONType(value)
+	if bsonType == "null" {
+		return
+	}
+	if _, ok := s.types[path]; !ok {
+		s.paths = append(s.paths, path)
+		s.types[path] = make(map[string]int)
+	}
+	s.types[path][bsonType]++
+}
+
+// bsonType returns the type of a field path in the sampled documents. Numeric types are widened,
+// e.g. a field holding both int and long values is a long. Otherwise the most frequent type wins.
+func (s *documentSchema) bsonType(path string) string {
+	types := make([]string, 0, len(s.types[path]))
+	for bsonType := range s.types[path] {
+		types = append(types, bsonType)
+	}
+	slices.Sort(types)
+
+	widest := -1
+	for _, bsonType := range types {
+		rank := slices.Index(bsonNumericTypes, bsonType)
+		if rank == -1 {
+			widest = -1
+			break
+		}
+		widest = max(widest, rank)
+	}
+	if widest != -1 {
+		return bsonNumericTypes[widest]
+	}
+
+	majority := types[0]
+	for _, bsonType := range types {
+		if s.types[path][bsonType] > s.types[path][majority] {
+			majority = bsonType
+		}
+	}
+	if len(types) > 1 {
+		Debug(fmt.Sprintf("Mixed types %v for field %s, using %s", types, path, majority))
+	}
+	return majority
+}
+
+// bsonNumericTypes are the numeric BSON types from narrowest to widest.
+var bsonNumericTypes = []string{"int", "long", "double", "decimal"}
+
+// documentBSONType returns the BSON type alias, as used by the $type operator, of a decoded value.
+func documentBSONType(value any) string {
+	switch value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return "null"
+	case string:
+		return "string"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case primitive.Decimal128:
+		return "decimal"
+	case bool:
+		return "bool"
+	case primitive.DateTime:
+		return "date"
+	case primitive.Timestamp:
+		return "timestamp"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.Binary:
+		return "binData"
+	case bson.M, bson.D, map[string]any:
+		return "object"
+	case bson.A:
+		return "array"
+	case primitive.Regex:
+		return "regex"
+	case primitive.JavaScript, primitive.CodeWithScope:
+		return "javascript"
+	case primitive.Symbol:
+		return "symbol"
+	}
+	return "unknown"
+}
+
+// bsonDuckdbTypeMap maps the BSON types stored in the information schema to DuckDB types.
+var bsonDuckdbTypeMap = map[string]string{
+	"string":     "varchar",
+	"int":        "integer",
+	"long":       "bigint",
+	"double":     "double",
+	"decimal":    "double",
+	"bool":       "boolean",
+	"date":       "timestamp",
+	"timestamp":  "timestamp",
+	"objectId":   "varchar",
+	"binData":    "blob",
+	"object":     "json",
+	"array":      "json",
+	"regex":      "varchar",
+	"javascript": "varchar",
+	"symbol":     "varchar",
+	"unknown":    "varchar",
+}
+
+// documentFieldTypes are the DuckDB types that document values can be converted to.
+var documentFieldTypes = map[string]bool{
+	"varchar":   true,
+	"json":      true,
+	"bigint":    true,
+	"integer":   true,
+	"smallint":  true,
+	"tinyint":   true,
+	"double":    true,
+	"real":      true,
+	"boolean":   true,
+	"date":      true,
+	"timestamp": true,
+	"blob":      true,
+	"uuid":      true,
+}
+
+// documentRow converts a document into a model row. Without fields, when no documents were sampled,
+// the document is stored as a single json column.
+func documentRow(r *Retriever, document bson.M) ([]driver.Value, error) {
+	if len(r.Fields) == 0 {
+		jsonBytes, err := json.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling result: %s", err)
+		}
+		return []driver.Value{r.Source.Name, string(jsonBytes)}, nil
+	}
+
+	driverRow := make([]driver.Value, len(r.Fields)+1)
+	driverRow[0] = r.Source.Name
+	for i, field := range r.Fields {
+		value, err := documentValue(lookupDocumentPath(document, field.Path), field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("error converting field %s: %w", field.Path, err)
+		}
+		driverRow[i+1] = value
+	}
+	return driverRow, nil
+}
+
+// lookupDocumentPath returns the value at a dotted path, e.g. address.city or items.0.sku.
+// Missing values are returned as nil.
+func lookupDocumentPath(document bson.M, path string) any {
+	var value any = document
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case bson.M:
+			value = v[key]
+		case map[string]any:
+			value = v[key]
+		case bson.D:
+			value = nil
+			for _, e := range v {
+				if e.Key == key {
+					value = e.Value
+					break
+				}
+			}
+		case bson.A:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil
+			}
+			value = v[idx]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// documentValue converts a BSON value into the go type the DuckDB appender expects for the field type.
+func documentValue(value any, fieldType string) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch duckdbType := duckdbTypeMap[strings.ToLower(fieldType)]; duckdbType {
+	case "varchar":
+		return documentString(value)
+	case "json":
+		jsonBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(jsonBytes), nil
+	case "bigint", "integer", "smallint", "tinyint":
+		i, err := documentInt(value)
+		if err != nil {
+			return nil, err
+		}
+		switch duckdbType {
+		case "integer":
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return nil, fmt.Errorf("%d overflows %s", i, duckdbType)
+			}
+			return int32(i), nil
+		case "smallint":
+			if i < math.MinInt16 || i > math.MaxInt16 {
+				return nil, fmt.Errorf("%d overflows %s", i, duckdbType)
+			}
+			return int16(i), nil
+		case "tinyint":
+			if i < math.MinInt8 || i > math.MaxInt8 {
+				return nil, fmt.Errorf("%d overflows %s", i, duckdbType)
+			}
+			return int8(i), nil
+		}
+		return i, nil
+	case "double", "real":
+		f, err := documentFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		if duckdbType == "real" {
+			return float32(f), nil
+		}
+		return f, nil
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "date", "timestamp":
+		switch v := value.(type) {
+		case primitive.DateTime:
+			return v.Time().UTC(), nil
+		case primitive.Timestamp:
+			return time.Unix(int64(v.T), 0).UTC(), nil
+		case time.Time:
+			return v.UTC(), nil
+		case string:
+			return time.Parse(time.RFC3339Nano, v)
+		}
+	case "blob":
+		switch v := value.(type) {
+		case primitive.Binary:
+			return v.Data, nil
+		case string:
+			return []byte(v), nil
+		}
+	case "uuid":
+		if v, ok := value.(primitive.Binary); ok && len(v.Data) == 16 {
+			return duckdb.UUID(v.Data), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, fieldType)
+}
+
+func documentString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano), nil
+	case primitive.Decimal128:
+		return v.String(), nil
+	case bson.M, bson.A, bson.D, map[string]any:
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonBytes), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func documentInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case primitive.Decimal128:
+		return strconv.ParseInt(v.String(), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %v to an integer", value)
+}
+
+func documentFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case primitive.Decimal128:
+		return strconv.ParseFloat(v.String(), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %v to a float", value)
+}
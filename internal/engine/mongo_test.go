@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateDocumentModel(t *testing.T) {
+	tests := []struct {
+		name        string
+		model       Model
+		expected    []DocumentField
+		expectError bool
+	}{
+		{"filter only", Model{Query: `{"status": "active"}`}, nil, false},
+		{"pipeline", Model{Pipeline: `[{"$unwind": "$items"}]`}, nil, false},
+		{"pipeline must be an array", Model{Pipeline: `{"$unwind": "$items"}`}, nil, true},
+		{"projection must be a document", Model{Projection: `["name"]`}, nil, true},
+		{
+			"field names and paths",
+			Model{Fields: []DocumentField{{Path: "address.city", Type: "varchar"}, {Name: "age", Type: "int"}}},
+			[]DocumentField{{Name: "address_city", Path: "address.city", Type: "varchar"}, {Name: "age", Path: "age", Type: "int"}},
+			false,
+		},
+		{"duplicate field name", Model{Fields: []DocumentField{{Name: "a", Type: "varchar"}, {Path: "a", Type: "bigint"}}}, nil, true},
+		{"inferred type", Model{Fields: []DocumentField{{Name: "a"}}}, []DocumentField{{Name: "a", Path: "a"}}, false},
+		{"unsupported type", Model{Fields: []DocumentField{{Name: "a", Type: "geometry"}}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDocumentModel(&tt.model)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.model.Fields, tt.expected) {
+				t.Errorf("fields = %+v; want %+v", tt.model.Fields, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDocumentRow(t *testing.T) {
+	id := primitive.NewObjectID()
+	price, err := primitive.ParseDecimal128("12.50")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC)
+	document := bson.M{
+		"_id":     id,
+		"name":    "Ada",
+		"age":     int32(36),
+		"created": primitive.NewDateTimeFromTime(created),
+		"address": bson.M{"city": "London", "zip": "N1"},
+		"items":   bson.A{bson.M{"sku": "A-1", "price": price}},
+		"active":  true,
+	}
+	r := &Retriever{
+		Source: Source{Name: "mongo-1"},
+		Fields: []DocumentField{
+			{Name: "id", Path: "_id", Type: "varchar"},
+			{Name: "age", Path: "age", Type: "bigint"},
+			{Name: "city", Path: "address.city", Type: "varchar"},
+			{Name: "price", Path: "items.0.price", Type: "double"},
+			{Name: "created", Path: "created", Type: "timestamp"},
+			{Name: "active", Path: "active", Type: "boolean"},
+			{Name: "address", Path: "address", Type: "json"},
+			{Name: "missing", Path: "items.3.sku", Type: "varchar"},
+		},
+	}
+
+	result, err := documentRow(r, document)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []driver.Value{"mongo-1", id.Hex(), int64(36), "London", 12.5, created, true, `{"city":"London","zip":"N1"}`, nil}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("documentRow() = %v; want %v", result, expected)
+	}
+
+	r.Fields = []DocumentField{{Name: "name", Path: "name", Type: "integer"}}
+	if _, err = documentRow(r, document); err == nil {
+		t.Errorf("expected error converting a string to an integer, got nil")
+	}
+}
+
+func TestDocumentValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       any
+		fieldType   string
+		expected    driver.Value
+		expectError bool
+	}{
+		{"int32 to integer", int32(7), "integer", int32(7), false},
+		{"integral double to smallint", float64(7), "smallint", int16(7), false},
+		{"int64 overflows tinyint", int64(300), "tinyint", nil, true},
+		{"fractional double to bigint", 1.5, "bigint", nil, true},
+		{"int64 to real", int64(2), "real", float32(2), false},
+		{"string to timestamp", "2024-03-05T10:20:30Z", "timestamp", time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC), false},
+		{"binary to blob", primitive.Binary{Data: []byte("hi")}, "blob", []byte("hi"), false},
+		{"array to varchar", bson.A{"a", "b"}, "varchar", `["a","b"]`, false},
+		{"nil", nil, "bigint", nil, false},
+		{"string to boolean", "true", "boolean", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := documentValue(tt.value, tt.fieldType)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("documentValue() = %#v; want %#v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDocumentSchema(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	documents := []bson.M{
+		{"_id": primitive.NewObjectID(), "age": int32(30), "score": int64(7), "tags": bson.A{"a"}, "address": bson.M{"city": "London"}},
+		{"_id": primitive.NewObjectID(), "age": int64(31), "score": "n/a", "tags": nil},
+		{"_id": primitive.NewObjectID(), "age": 31.5, "score": "unknown"},
+	}
+
+	schema := newDocumentSchema()
+	for _, document := range documents {
+		schema.observe(document, nil)
+	}
+	expected := map[string]string{"_id": "objectId", "address": "object", "age": "double", "score": "string", "tags": "array"}
+	result := make(map[string]string)
+	for _, path := range schema.paths {
+		result[path] = schema.bsonType(path)
+	}
+	if !reflect.DeepEqual(result, expected) || schema.documents != 3 {
+		t.Errorf("bsonType() = %v; want %v", result, expected)
+	}
+
+	// Declared fields are described by their paths
+	schema = newDocumentSchema()
+	for _, document := range documents {
+		schema.observe(document, []DocumentField{{Name: "city", Path: "address.city"}, {Name: "zip", Path: "address.zip"}})
+	}
+	if !reflect.DeepEqual(schema.paths, []string{"address.city"}) || schema.bsonType("address.city") != "string" {
+		t.Errorf("paths = %v; want [address.city]", schema.paths)
+	}
+}
+
+func TestParseDocumentModelColumns(t *testing.T) {
+	model := &Model{Name: "customers", Type: "database", Fields: []DocumentField{
+		{Name: "city", Path: "address.city"},
+		{Name: "age", Path: "age", Type: "smallint"},
+	}}
+	columnMetadata := ColumnMetadata{"customers": {"address.city": ColumnType{MajorityType: "string"}}}
+	if err := ParseModelColumns(&ModelConfig{Models: []*Model{model}}, columnMetadata); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `preen_source_name varchar, "city" varchar, "age" smallint`
+	if model.DDLString != expected || model.Fields[0].Type != "varchar" {
+		t.Errorf("DDLString = %s; want %s", model.DDLString, expected)
+	}
+
+	model.Fields = []DocumentField{{Name: "zip", Path: "address.zip"}}
+	if err := ParseModelColumns(&ModelConfig{Models: []*Model{model}}, columnMetadata); err == nil {
+		t.Errorf("expected error for a field missing from the sampled documents, got nil")
+	}
+}
+
+func TestParseDocumentModelColumnsWithoutFields(t *testing.T) {
+	Initialize()
+	model := &Model{Name: "orders", Type: "database"}
+	columnMetadata := ColumnMetadata{"orders": {
+		"total":             ColumnType{MajorityType: "double"},
+		"_id":               ColumnType{MajorityType: "objectId"},
+		"items":             ColumnType{MajorityType: "array"},
+		"created":           ColumnType{MajorityType: "date"},
+		"preen_source_name": ColumnType{MajorityType: "string"},
+	}}
+	if err := ParseModelColumns(&ModelConfig{Models: []*Model{model}}, columnMetadata); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `preen_source_name varchar, "_id" varchar, "created" timestamp, "items" json, "total" double`
+	if model.DDLString != expected {
+		t.Errorf("DDLString = %s; want %s", model.DDLString, expected)
+	}
+	if len(model.Fields) != 4 || model.Fields[1].Path != "created" || model.Fields[1].Type != "timestamp" {
+		t.Errorf("Fields = %+v; want the sampled top-level fields", model.Fields)
+	}
+
+	// Without sampled documents the whole document is stored as json
+	model = &Model{Name: "archive", Type: "database"}
+	if err := ParseModelColumns(&ModelConfig{Models: []*Model{model}}, columnMetadata); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected = "preen_source_name varchar, document json"; model.DDLString != expected {
+		t.Errorf("DDLString = %s; want %s", model.DDLString, expected)
+	}
+}
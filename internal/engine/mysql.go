@@ -9,12 +9,31 @@ import (
 	"reflect"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 func GetMysqlPoolFromSource(source Source) (*sql.DB, error) {
+	dsn, err := mysqlDSN(source)
+	if err != nil {
+		return nil, err
+	}
+	dbpool, err := getMysqlPool(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dbpool, nil
+}
+
+// mysqlDSN builds the driver's data source name for a source, from its uri or its connection fields.
+// The tls config of a source is registered with the driver under the source's name.
+func mysqlDSN(source Source) (string, error) {
+	if source.Connection.URI != "" {
+		return mysqlURIDSN(source)
+	}
 	// Example url := "root:thisisnotarealpassword@tcp(127.0.0.1:33061)/mysql_db_1"
-	url := fmt.Sprintf(
+	dsn := fmt.Sprintf(
 		"%s:%s@tcp(%s:%d)/%s?parseTime=true",
 		source.Connection.Username,
 		url.QueryEscape(source.Connection.Password),
@@ -22,13 +41,54 @@ func GetMysqlPoolFromSource(source Source) (*sql.DB, error) {
 		source.Connection.Port,
 		source.Connection.Database,
 	)
-	dbpool, err := getMysqlPool(url)
+	if options := connectionOptions(source); len(options) > 0 {
+		dsn += "&" + options.Encode()
+	}
+	tlsName, err := mysqlTLSConfigName(source)
+	if err != nil {
+		return "", err
+	}
+	if tlsName != "" {
+		dsn += "&tls=" + url.QueryEscape(tlsName)
+	}
+	return dsn, nil
+}
 
+// mysqlURIDSN returns the uri of a source with the settings preen relies on applied, e.g. parseTime
+// for scanning timestamps. The uri may use any network the driver supports, such as a unix socket.
+func mysqlURIDSN(source Source) (string, error) {
+	config, err := mysql.ParseDSN(source.Connection.URI)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("invalid mysql uri: %w", err)
 	}
+	config.ParseTime = true
+	tlsName, err := mysqlTLSConfigName(source)
+	if err != nil {
+		return "", err
+	}
+	if tlsName != "" {
+		config.TLSConfig = tlsName
+	}
+	return config.FormatDSN(), nil
+}
 
-	return dbpool, nil
+// mysqlTLSConfigName returns the value of the tls parameter for a source's tls block, empty if it has none.
+func mysqlTLSConfigName(source Source) (string, error) {
+	switch tlsMode(source) {
+	case "":
+		return "", nil
+	case "disable":
+		return "false", nil
+	}
+	tlsConf, err := tlsConfig(source)
+	if err != nil {
+		return "", err
+	}
+	tlsName := fmt.Sprintf("preen-%s", source.Name)
+	if err = mysql.RegisterTLSConfig(tlsName, tlsConf); err != nil {
+		return "", fmt.Errorf("error registering tls config: %w", err)
+	}
+	return tlsName, nil
 }
 
 func getMysqlPool(url string) (*sql.DB, error) {
@@ -44,24 +104,90 @@ func getMysqlPool(url string) (*sql.DB, error) {
 	return dbPool, nil
 }
 
-// Retrieve retrieves data from a MySQL source and sends it to the insert channel.
-func ingestMysqlModel(r *Retriever, ic chan []driver.Value) error {
-	Debug(fmt.Sprintf("Retrieving context %s for %s", r.ModelName, r.Source.Name))
-	clientPool, err := GetMysqlPoolFromSource(r.Source)
+type mysqlEngine struct {
+	source Source
+	pool   *sql.DB
+}
+
+func init() {
+	RegisterSourceEngine("mysql", newMysqlEngine)
+}
+
+func newMysqlEngine(source Source) SourceEngine {
+	return &mysqlEngine{source: source}
+}
+
+func (e *mysqlEngine) Connect() error {
+	pool, err := GetMysqlPoolFromSource(e.source)
 	if err != nil {
 		return err
 	}
-	defer clientPool.Close()
-	rows, err := clientPool.Query(r.Query)
+	e.pool = pool
+	return nil
+}
+
+// DescribeColumns queries the mysql information schema for the tables used by a SQL model.
+// MySQL does not have schemas, so a qualified table is looked up in the database it is qualified with
+// and an unqualified table in the source's database.
+func (e *mysqlEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	if model.Type != "database" || model.Parsed == nil || len(model.TableSet) == 0 {
+		return nil
+	}
+	database := e.source.Connection.Database
+
+	query := fmt.Sprintf(`
+		select table_schema, table_name, column_name, data_type from information_schema.columns
+		where %s;
+	`, tableSetCondition(model.TableSet, "table_schema", "table_name", quoteLiteral(database)))
+
+	rows, err := e.pool.Query(query)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	if err = processMysqlRows(r, ic, rows); err != nil {
+	for rows.Next() {
+		var table_schema string
+		var table_name string
+		var column_name string
+		var data_type string
+		if err = rows.Scan(&table_schema, &table_name, &column_name, &data_type); err != nil {
+			return err
+		}
+		for _, tableName := range tableSetNames(model.TableSet, table_schema, table_name, database) {
+			ic <- []driver.Value{e.source.Name, string(model.Name), string(tableName), column_name, data_type}
+		}
+	}
+	return rows.Err()
+}
+
+// Stream retrieves data from a MySQL source and sends it to the insert channel.
+func (e *mysqlEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	if r.CDC != nil {
+		return e.streamChanges(r, ic)
+	}
+	rows, err := e.pool.Query(r.Query)
+	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	return processMysqlRows(r, ic, rows)
+}
+
+func (e *mysqlEngine) Query(query string) ([]map[string]any, error) {
+	rows, err := e.pool.Query(query)
+	if err != nil {
+		return nil, err
+	}
 
+	return collectRows(rows)
+}
+
+func (e *mysqlEngine) Close() error {
+	if e.pool != nil {
+		return e.pool.Close()
+	}
 	return nil
 }
 
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-sql-driver/mysql"
+)
+
+// The binlog is read with go-mysql's replication client, which registers as a replica, requests the
+// binlog dump and decodes the events. Preen only applies the row events of its CDC models.
+
+// binlogPosition is a position in the mysql binlog, stored as the binlog file and offset, e.g. binlog.000042:1337.
+type binlogPosition struct {
+	file string
+	pos  uint32
+}
+
+func parseBinlogPosition(position string) (binlogPosition, error) {
+	i := strings.LastIndex(position, ":")
+	if i <= 0 {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position %s", position)
+	}
+	pos, err := strconv.ParseUint(position[i+1:], 10, 32)
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position %s: %w", position, err)
+	}
+	return binlogPosition{file: position[:i], pos: uint32(pos)}, nil
+}
+
+func (p binlogPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.pos)
+}
+
+// before reports whether p is an earlier position than other. Binlog files are numbered with a fixed
+// width, so their names sort in the order they are written.
+func (p binlogPosition) before(other binlogPosition) bool {
+	if p.file != other.file {
+		return p.file < other.file
+	}
+	return p.pos < other.pos
+}
+
+// binlogSyncerConfig returns the replication client settings of a source, read from the same DSN the
+// mysql driver connects with so uris, unix sockets and tls settings apply to both.
+func binlogSyncerConfig(source Source, serverID uint32) (replication.BinlogSyncerConfig, error) {
+	dsn, err := mysqlDSN(source)
+	if err != nil {
+		return replication.BinlogSyncerConfig{}, err
+	}
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return replication.BinlogSyncerConfig{}, err
+	}
+
+	syncerConfig := replication.BinlogSyncerConfig{
+		ServerID:  serverID,
+		Flavor:    gomysql.MySQLFlavor,
+		Host:      config.Addr,
+		User:      config.User,
+		Password:  config.Passwd,
+		TLSConfig: config.TLS,
+		// Timestamps are written to the binlog in UTC
+		TimestampStringLocation: time.UTC,
+		// Errors are returned by the stream, retrying would read past the end of the build
+		DisableRetrySync: true,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if config.Net == "tcp" {
+		host, port, err := net.SplitHostPort(config.Addr)
+		if err != nil {
+			return replication.BinlogSyncerConfig{}, err
+		}
+		portNumber, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return replication.BinlogSyncerConfig{}, fmt.Errorf("invalid mysql port %s: %w", port, err)
+		}
+		syncerConfig.Host, syncerConfig.Port = host, uint16(portNumber)
+	}
+	return syncerConfig, nil
+}
+
+// readBinlog reads the binlog from the start position up to the end position. fn is called with every
+// event and the binlog position after the event. Events the server generates for the connection, such as
+// the rotate to the requested file, are skipped.
+func readBinlog(source Source, start binlogPosition, end binlogPosition, serverID uint32, fn func(event *replication.BinlogEvent, position binlogPosition) error) error {
+	if !start.before(end) {
+		return nil
+	}
+	config, err := binlogSyncerConfig(source, serverID)
+	if err != nil {
+		return err
+	}
+	syncer := replication.NewBinlogSyncer(config)
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(gomysql.Position{Name: start.file, Pos: start.pos})
+	if err != nil {
+		return err
+	}
+	position := start
+	for position.before(end) {
+		event, err := streamer.GetEvent(context.Background())
+		if err != nil {
+			return err
+		}
+		if event.Header.Flags&replication.LOG_EVENT_ARTIFICIAL_F != 0 {
+			continue
+		}
+		if rotate, ok := event.Event.(*replication.RotateEvent); ok {
+			position = binlogPosition{file: string(rotate.NextLogName), pos: uint32(rotate.Position)}
+		} else if event.Header.LogPos > 0 {
+			position.pos = event.Header.LogPos
+		}
+		if err = fn(event, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
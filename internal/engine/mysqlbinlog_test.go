@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/preendata/sqlparser"
+)
+
+func TestParseBinlogPosition(t *testing.T) {
+	tests := []struct {
+		position    string
+		expected    binlogPosition
+		expectError bool
+	}{
+		{"binlog.000042:1337", binlogPosition{file: "binlog.000042", pos: 1337}, false},
+		{"mysql-bin:01.000001:4", binlogPosition{file: "mysql-bin:01.000001", pos: 4}, false},
+		{"binlog.000042", binlogPosition{}, true},
+		{"binlog.000042:abc", binlogPosition{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			result, err := parseBinlogPosition(tt.position)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected || result.String() != tt.position {
+				t.Errorf("parseBinlogPosition() = %v; want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseEnumLabels(t *testing.T) {
+	result := parseEnumLabels("enum('new','it''s paid','a,b')")
+	expected := []string{"new", "it's paid", "a,b"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseEnumLabels() = %v; want %v", result, expected)
+	}
+}
+
+func TestBinlogColumnValue(t *testing.T) {
+	tests := []struct {
+		column   binlogColumn
+		value    any
+		expected driver.Value
+	}{
+		{binlogColumn{dataType: "int"}, int32(-42), int32(-42)},
+		{binlogColumn{dataType: "tinyint", unsigned: true}, int8(-56), nil},
+		{binlogColumn{dataType: "tinyint", unsigned: true}, int8(100), int8(100)},
+		{binlogColumn{dataType: "smallint", unsigned: true}, int16(-1), nil},
+		{binlogColumn{dataType: "mediumint", unsigned: true}, int32(-1), int32(16777215)},
+		{binlogColumn{dataType: "bigint", unsigned: true}, int64(-1), nil},
+		{binlogColumn{dataType: "year"}, 2024, int16(2024)},
+		{binlogColumn{dataType: "decimal"}, "1234.56", 1234.56},
+		{binlogColumn{dataType: "float"}, float32(0.5), 0.5},
+		{binlogColumn{dataType: "date"}, "2024-03-05", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{binlogColumn{dataType: "datetime"}, "2024-03-05 10:20:30.250000", time.Date(2024, 3, 5, 10, 20, 30, 250000000, time.UTC)},
+		{binlogColumn{dataType: "timestamp"}, "0000-00-00 00:00:00", time.Time{}},
+		{binlogColumn{dataType: "time"}, "-12:30:00", "-12:30:00"},
+		{binlogColumn{dataType: "bit", bits: 12}, int64(0x0a0b), []byte{0x0a, 0x0b}},
+		{binlogColumn{dataType: "binary"}, "ab", []byte("ab")},
+		{binlogColumn{dataType: "text"}, []byte("Ada"), "Ada"},
+		{binlogColumn{dataType: "varchar"}, "Ada", "Ada"},
+		{binlogColumn{dataType: "json"}, `{"a":1}`, `{"a":1}`},
+		{binlogColumn{dataType: "json"}, []byte{}, "null"},
+		{binlogColumn{dataType: "enum", labels: []string{"new", "paid"}}, int64(2), "paid"},
+		{binlogColumn{dataType: "enum", labels: []string{"new", "paid"}}, int64(0), ""},
+		{binlogColumn{dataType: "set", labels: []string{"a", "b", "c"}}, int64(5), "a,c"},
+		{binlogColumn{dataType: "int"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		tt.column.name = "c"
+		result, err := tt.column.value(tt.value)
+		if err != nil {
+			// Values outside the range of the scanned type are rejected
+			if tt.expected != nil {
+				t.Errorf("value(%v) of %s: unexpected error: %v", tt.value, tt.column.dataType, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("value(%v) of %s = %#v; want %#v", tt.value, tt.column.dataType, result, tt.expected)
+		}
+	}
+}
+
+// binlogOrderRow builds a row of shop.orders (id int, name varchar(255), amount decimal(10,2),
+// created datetime, status enum('new','paid'), score tinyint unsigned) as decoded by the replication client.
+func binlogOrderRow(id int32, name string, status int64) []any {
+	return []any{id, name, "1234.56", "2024-03-05 10:20:30", status, int8(-56)}
+}
+
+func binlogRowsEvent(eventType replication.EventType, pos uint32, rows ...[]any) *replication.BinlogEvent {
+	skipped := make([][]int, len(rows))
+	for i := range skipped {
+		skipped[i] = []int{}
+	}
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: eventType, LogPos: pos},
+		Event: &replication.RowsEvent{
+			Table:          &replication.TableMapEvent{Schema: []byte("shop"), Table: []byte("orders")},
+			ColumnCount:    6,
+			Rows:           rows,
+			SkippedColumns: skipped,
+		},
+	}
+}
+
+func binlogQueryEvent(pos uint32, query string) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: pos},
+		Event:  &replication.QueryEvent{Schema: []byte("shop"), Query: []byte(query)},
+	}
+}
+
+func TestBinlogApplier(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmt, err := sqlparser.Parse("select id, status, amount as total from orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	model := &Model{Name: "orders", Parsed: stmt, CDC: &CDC{PrimaryKey: []string{"id"}}}
+	if err = validateCDC(model); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	columns := []binlogColumn{
+		{name: "id", dataType: "int"},
+		{name: "name", dataType: "varchar"},
+		{name: "amount", dataType: "decimal"},
+		{name: "created", dataType: "datetime"},
+		{name: "status", dataType: "enum", labels: []string{"new", "paid"}},
+		{name: "score", dataType: "tinyint", unsigned: true},
+	}
+	source := Source{Name: "shop-db"}
+	start := binlogPosition{file: "binlog.000001", pos: 4}
+	r := &Retriever{Source: source, CDC: newCDCProgress(model, source, "orders", start.String())}
+	a, err := newBinlogApplier(r, "shop", columns, start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	xid := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.XID_EVENT, LogPos: 350},
+		Event:  &replication.XIDEvent{},
+	}
+	// With binlog_row_image MINIMAL the before image of an update only holds the key
+	minimalUpdate := binlogRowsEvent(replication.UPDATE_ROWS_EVENTv2, 260, []any{int32(2), nil, nil, nil, nil, nil}, []any{nil, nil, nil, nil, int64(2), nil})
+	minimalUpdate.Event.(*replication.RowsEvent).SkippedColumns = [][]int{{1, 2, 3, 4, 5}, {0, 1, 2, 3, 5}}
+	otherTable := binlogRowsEvent(replication.WRITE_ROWS_EVENTv2, 270, []any{int32(9)})
+	otherTable.Event.(*replication.RowsEvent).Table.Table = []byte("customers")
+
+	events := []*replication.BinlogEvent{
+		binlogQueryEvent(100, "BEGIN"),
+		binlogRowsEvent(replication.WRITE_ROWS_EVENTv2, 200, binlogOrderRow(1, "Ada", 1), binlogOrderRow(2, "Bob", 1)),
+		binlogRowsEvent(replication.UPDATE_ROWS_EVENTv2, 250, binlogOrderRow(1, "Ada", 1), binlogOrderRow(1, "Ada", 2)),
+		minimalUpdate,
+		otherTable,
+		binlogRowsEvent(replication.DELETE_ROWS_EVENTv2, 300, binlogOrderRow(2, "Bob", 2)),
+		xid,
+		// Uncommitted transactions are read again by the next build
+		binlogQueryEvent(400, "BEGIN"),
+		binlogRowsEvent(replication.WRITE_ROWS_EVENTv2, 500, binlogOrderRow(3, "Cy", 1)),
+	}
+	for _, event := range events {
+		position := binlogPosition{file: start.file, pos: event.Header.LogPos}
+		if err = a.apply(event, position); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if a.committed.String() != "binlog.000001:350" {
+		t.Errorf("committed = %s; want binlog.000001:350", a.committed)
+	}
+
+	ic := make(chan []driver.Value, 10)
+	a.flush(ic)
+	close(ic)
+	upserts := make([][]driver.Value, 0)
+	for row := range ic {
+		upserts = append(upserts, row)
+	}
+	expectedUpserts := [][]driver.Value{{"shop-db", int32(1), "paid", 1234.56}}
+	if !reflect.DeepEqual(upserts, expectedUpserts) {
+		t.Errorf("upserts = %v; want %v", upserts, expectedUpserts)
+	}
+	expectedDeletes := [][]driver.Value{{"shop-db", int32(2), "paid", 1234.56}}
+	if !reflect.DeepEqual(r.CDC.deletes, expectedDeletes) {
+		t.Errorf("deletes = %v; want %v", r.CDC.deletes, expectedDeletes)
+	}
+
+	if err = a.apply(binlogQueryEvent(600, "TRUNCATE TABLE `orders`"), binlogPosition{file: start.file, pos: 600}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.CDC.replace || len(a.pending) != 0 || a.committed.pos != 600 {
+		t.Errorf("truncate did not reset the pending changes")
+	}
+
+	changed := binlogRowsEvent(replication.WRITE_ROWS_EVENTv2, 700, []any{int32(4)})
+	changed.Event.(*replication.RowsEvent).ColumnCount = 7
+	if err = a.apply(changed, binlogPosition{file: start.file, pos: 700}); err == nil {
+		t.Errorf("expected error for a changed table, got nil")
+	}
+}
+
+func TestBinlogPositionBefore(t *testing.T) {
+	tests := []struct {
+		a, b     binlogPosition
+		expected bool
+	}{
+		{binlogPosition{"binlog.000001", 4}, binlogPosition{"binlog.000001", 120}, true},
+		{binlogPosition{"binlog.000001", 120}, binlogPosition{"binlog.000001", 120}, false},
+		{binlogPosition{"binlog.000001", 900}, binlogPosition{"binlog.000002", 4}, true},
+		{binlogPosition{"binlog.000010", 4}, binlogPosition{"binlog.000009", 900}, false},
+	}
+	for _, tt := range tests {
+		if result := tt.a.before(tt.b); result != tt.expected {
+			t.Errorf("%s.before(%s) = %v; want %v", tt.a, tt.b, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package engine
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var truncateRegex = regexp.MustCompile("(?is)^\\s*truncate\\s+(?:table\\s+)?([`\\w$.]+)")
+
+// streamChanges retrieves a CDC model. Without a stored position the table is snapshotted, otherwise the
+// row events committed between the stored position and the end of the binlog are read. Inserted and updated rows are
+// sent to the staging table, deleted keys are kept on the retriever's progress.
+func (e *mysqlEngine) streamChanges(r *Retriever, ic chan []driver.Value) error {
+	progress := r.CDC
+	if err := e.checkBinlogFormat(); err != nil {
+		return err
+	}
+	if progress.position == "" {
+		return e.snapshotTable(r, ic)
+	}
+	start, err := parseBinlogPosition(progress.position)
+	if err != nil {
+		return err
+	}
+
+	columns, err := e.binlogColumns(progress.config)
+	if err != nil {
+		return err
+	}
+	applier, err := newBinlogApplier(r, e.source.Connection.Database, columns, start)
+	if err != nil {
+		return err
+	}
+	defer applier.close()
+	end, err := e.currentBinlogPosition()
+	if err != nil {
+		return err
+	}
+	err = readBinlog(e.source, start, end, progress.serverID, applier.apply)
+	var mysqlErr *mysql.MyError
+	if errors.As(err, &mysqlErr) && mysqlErr.Code == mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG {
+		Warn(fmt.Sprintf("Binlog position %s not available on source %s: %s. Snapshotting %s again", progress.position, r.Source.Name, mysqlErr.Message, r.ModelName))
+		return e.snapshotTable(r, ic)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading binlog from %s: %w", progress.position, err)
+	}
+
+	progress.endPosition = applier.committed.String()
+	applier.flush(ic)
+	return nil
+}
+
+// checkBinlogFormat checks that the source writes a binlog with the rows of every change.
+func (e *mysqlEngine) checkBinlogFormat() error {
+	var logBin int
+	var format string
+	if err := e.pool.QueryRow("select @@global.log_bin, @@global.binlog_format").Scan(&logBin, &format); err != nil {
+		return fmt.Errorf("error reading binlog settings: %w", err)
+	}
+	if logBin != 1 {
+		return fmt.Errorf("cdc models require binary logging, which is not enabled on source %s", e.source.Name)
+	}
+	if !strings.EqualFold(format, "ROW") {
+		return fmt.Errorf("cdc models require binlog_format ROW, source %s uses %s", e.source.Name, format)
+	}
+	return nil
+}
+
+// snapshotTable retrieves every row of the model and stores the binlog position the next build reads
+// changes from. The position is read before the table. Changes committed while the table is read are
+// replayed by the next build, which is harmless as changes are applied by primary key.
+func (e *mysqlEngine) snapshotTable(r *Retriever, ic chan []driver.Value) error {
+	progress := r.CDC
+	Info(fmt.Sprintf("Snapshotting %s from %s for change data capture", r.ModelName, r.Source.Name))
+
+	position, err := e.currentBinlogPosition()
+	if err != nil {
+		return err
+	}
+	progress.endPosition = position.String()
+	progress.replace = true
+
+	rows, err := e.pool.Query(r.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return processMysqlRows(r, ic, rows)
+}
+
+// currentBinlogPosition reads the position the next binlog event is written at.
+func (e *mysqlEngine) currentBinlogPosition() (binlogPosition, error) {
+	// MySQL 8.2 renamed show master status, older versions and MariaDB only know the old name
+	rows, err := e.pool.Query("show binary log status")
+	if err != nil {
+		rows, err = e.pool.Query("show master status")
+	}
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("error reading binlog position: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return binlogPosition{}, err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return binlogPosition{}, err
+		}
+		return binlogPosition{}, fmt.Errorf("binary logging is not enabled on source %s", e.source.Name)
+	}
+	values := make([]sql.NullString, len(columns))
+	scanArgs := make([]any, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	if err = rows.Scan(scanArgs...); err != nil {
+		return binlogPosition{}, err
+	}
+	fileIndex, posIndex := slices.Index(columns, "File"), slices.Index(columns, "Position")
+	if fileIndex == -1 || posIndex == -1 {
+		return binlogPosition{}, fmt.Errorf("unexpected binlog status columns %v", columns)
+	}
+	return parseBinlogPosition(values[fileIndex].String + ":" + values[posIndex].String)
+}
+
+// binlogColumn is a column of the replicated table as described by the information schema. Row events
+// only hold the position of every column, and the indexes of enum and set values.
+type binlogColumn struct {
+	name     string
+	dataType string
+	unsigned bool
+	labels   []string
+	// Width of bit columns, which the driver scans to ceil(bits / 8) bytes
+	bits int
+}
+
+func (e *mysqlEngine) binlogColumns(config *CDC) ([]binlogColumn, error) {
+	schema := config.tableSchema(e.source.Connection.Database)
+	rows, err := e.pool.Query(`
+		select column_name, data_type, column_type from information_schema.columns
+		where table_schema = ? and table_name = ?
+		order by ordinal_position`, schema, config.table)
+	if err != nil {
+		return nil, fmt.Errorf("error querying mysql information schema: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make([]binlogColumn, 0)
+	for rows.Next() {
+		var column binlogColumn
+		var columnType string
+		if err = rows.Scan(&column.name, &column.dataType, &columnType); err != nil {
+			return nil, err
+		}
+		column.dataType = strings.ToLower(column.dataType)
+		column.unsigned = strings.Contains(strings.ToLower(columnType), "unsigned")
+		switch column.dataType {
+		case "enum", "set":
+			column.labels = parseEnumLabels(columnType)
+		case "bit":
+			if _, err = fmt.Sscanf(strings.ToLower(columnType), "bit(%d)", &column.bits); err != nil {
+				return nil, fmt.Errorf("unexpected type %s of column %s", columnType, column.name)
+			}
+		}
+		columns = append(columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", schema, config.table)
+	}
+	return columns, nil
+}
+
+// parseEnumLabels reads the labels of an enum or set column type such as enum('new','paid').
+func parseEnumLabels(columnType string) []string {
+	labels := make([]string, 0)
+	var label strings.Builder
+	quoted := false
+	for i := 0; i < len(columnType); i++ {
+		c := columnType[i]
+		switch {
+		case c == '\'' && quoted && i+1 < len(columnType) && columnType[i+1] == '\'':
+			label.WriteByte('\'')
+			i++
+		case c == '\'' && quoted:
+			labels = append(labels, label.String())
+			label.Reset()
+			quoted = false
+		case c == '\'':
+			quoted = true
+		case quoted:
+			label.WriteByte(c)
+		}
+	}
+	return labels
+}
+
+// value converts a binlog value decoded by the replication client into the type the mysql driver scans
+// the column to, so changes are inserted like the rows of a snapshot. The replication client decodes
+// integers as signed, times as strings, and enums and sets as their index and bitmask.
+func (c binlogColumn) value(value any) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch c.dataType {
+	case "tinyint", "smallint", "year", "mediumint", "int", "bigint":
+		return c.integerValue(value)
+	case "decimal", "numeric", "float", "double", "real":
+		switch v := value.(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case "date":
+		if v, ok := value.(string); ok {
+			return parseBinlogTime("2006-01-02", v)
+		}
+	case "datetime", "timestamp":
+		if v, ok := value.(string); ok {
+			return parseBinlogTime("2006-01-02 15:04:05.999999", v)
+		}
+	case "time":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "bit":
+		if v, ok := value.(int64); ok {
+			bytes := binary.BigEndian.AppendUint64(nil, uint64(v))
+			return bytes[8-(c.bits+7)/8:], nil
+		}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		switch v := value.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		}
+	case "json":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			// Empty documents are written for invalid values inserted without strict mode
+			if len(v) == 0 {
+				return "null", nil
+			}
+			return string(v), nil
+		}
+	case "enum":
+		if index, ok := value.(int64); ok {
+			if index <= 0 || int(index) > len(c.labels) {
+				return "", nil
+			}
+			return c.labels[index-1], nil
+		}
+	case "set":
+		if bits, ok := value.(int64); ok {
+			members := make([]string, 0)
+			for i, label := range c.labels {
+				if bits&(1<<i) != 0 {
+					members = append(members, label)
+				}
+			}
+			return strings.Join(members, ","), nil
+		}
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %T for %s column %s", value, c.dataType, c.name)
+}
+
+// parseBinlogTime parses a date or datetime. Zero dates are scanned to the zero time, like the driver does.
+func parseBinlogTime(layout string, value string) (time.Time, error) {
+	if strings.HasPrefix(value, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	return time.Parse(layout, value)
+}
+
+func (c binlogColumn) integerValue(value any) (driver.Value, error) {
+	// Unsigned columns are decoded to the signed integer of the same width
+	var n int64
+	switch v := value.(type) {
+	case int8:
+		n = int64(v)
+		if c.unsigned {
+			n = int64(uint8(v))
+		}
+	case int16:
+		n = int64(v)
+		if c.unsigned {
+			n = int64(uint16(v))
+		}
+	case int32:
+		n = int64(v)
+		if c.unsigned && c.dataType == "mediumint" {
+			n = int64(uint32(v) & 0xffffff)
+		} else if c.unsigned {
+			n = int64(uint32(v))
+		}
+	case int64:
+		if c.unsigned && v < 0 {
+			return nil, fmt.Errorf("value %d of column %s is out of range", uint64(v), c.name)
+		}
+		n = v
+	case int:
+		n = int64(v)
+	default:
+		return nil, fmt.Errorf("unsupported value %T for %s column %s", value, c.dataType, c.name)
+	}
+
+	var minValue, maxValue int64
+	switch c.dataType {
+	case "tinyint":
+		minValue, maxValue = math.MinInt8, math.MaxInt8
+	case "smallint", "year":
+		minValue, maxValue = math.MinInt16, math.MaxInt16
+	case "mediumint", "int":
+		minValue, maxValue = math.MinInt32, math.MaxInt32
+	default:
+		return n, nil
+	}
+	if n < minValue || n > maxValue {
+		return nil, fmt.Errorf("value %d of column %s is out of range", n, c.name)
+	}
+	switch c.dataType {
+	case "tinyint":
+		return int8(n), nil
+	case "smallint", "year":
+		return int16(n), nil
+	default:
+		return int32(n), nil
+	}
+}
+
+// binlogRows are the rows of a rows event. Whether they were inserted, updated or deleted is read from
+// the event header.
+type binlogRows struct {
+	eventType replication.EventType
+	*replication.RowsEvent
+}
+
+// binlogApplier folds the row events of the replicated table into the latest state of every changed row.
+// Events are applied when their transaction commits, so the stored position never splits a transaction.
+type binlogApplier struct {
+	*cdcChanges
+	schema  string
+	columns []binlogColumn
+	// Position of every model column in the replicated table's rows
+	columnIndexes []int
+	transaction   []binlogRows
+	// Position after the last applied transaction
+	committed binlogPosition
+}
+
+func newBinlogApplier(r *Retriever, database string, columns []binlogColumn, start binlogPosition) (*binlogApplier, error) {
+	a := &binlogApplier{
+		cdcChanges: newCDCChanges(r),
+		schema:     r.CDC.config.tableSchema(database),
+		columns:    columns,
+		committed:  start,
+	}
+	for _, name := range r.CDC.config.columns {
+		index := slices.IndexFunc(columns, func(c binlogColumn) bool { return strings.EqualFold(c.name, name) })
+		if index == -1 {
+			return nil, fmt.Errorf("column %s not found in replicated table %s.%s", name, a.schema, r.CDC.config.table)
+		}
+		a.columnIndexes = append(a.columnIndexes, index)
+	}
+	return a, nil
+}
+
+func (a *binlogApplier) apply(event *replication.BinlogEvent, position binlogPosition) error {
+	switch e := event.Event.(type) {
+	case *replication.RowsEvent:
+		if e.Table == nil || !a.isTable(string(e.Table.Schema), string(e.Table.Table)) {
+			return nil
+		}
+		if event.Header.EventType == replication.PARTIAL_UPDATE_ROWS_EVENT {
+			return fmt.Errorf("partial json updates are not supported, disable binlog_row_value_options")
+		}
+		if int(e.ColumnCount) != len(a.columns) {
+			return fmt.Errorf(
+				"table %s.%s has %d columns in the binlog and %d in the information schema. Run a full refresh after changing the table",
+				e.Table.Schema, e.Table.Table, e.ColumnCount, len(a.columns),
+			)
+		}
+		a.transaction = append(a.transaction, binlogRows{eventType: event.Header.EventType, RowsEvent: e})
+	case *replication.TransactionPayloadEvent:
+		// Compressed transactions hold their events, which end at the position of the payload
+		for _, payloadEvent := range e.Events {
+			if err := a.apply(payloadEvent, position); err != nil {
+				return err
+			}
+		}
+	case *replication.XIDEvent:
+		return a.commit(position)
+	case *replication.QueryEvent:
+		statement := strings.ToUpper(strings.TrimSpace(string(e.Query)))
+		if statement == "BEGIN" || strings.HasPrefix(statement, "SAVEPOINT") || strings.HasPrefix(statement, "ROLLBACK TO") {
+			return nil
+		}
+		// Other statements end the transaction, DDL commits implicitly
+		if a.isTruncate(string(e.Schema), string(e.Query)) {
+			a.transaction = nil
+			a.truncate()
+		}
+		return a.commit(position)
+	}
+	return nil
+}
+
+func (a *binlogApplier) isTable(schema string, table string) bool {
+	return strings.EqualFold(schema, a.schema) && strings.EqualFold(table, a.r.CDC.config.table)
+}
+
+func (a *binlogApplier) isTruncate(schema string, query string) bool {
+	match := truncateRegex.FindStringSubmatch(query)
+	if match == nil {
+		return false
+	}
+	parts := strings.Split(strings.ReplaceAll(match[1], "`", ""), ".")
+	if len(parts) == 1 {
+		return a.isTable(schema, parts[0])
+	}
+	return a.isTable(parts[0], parts[1])
+}
+
+// commit applies the rows events of the transaction that ended at position.
+func (a *binlogApplier) commit(position binlogPosition) error {
+	for _, rows := range a.transaction {
+		if err := a.applyRows(rows); err != nil {
+			return err
+		}
+	}
+	a.transaction = nil
+	a.committed = position
+	return nil
+}
+
+func (a *binlogApplier) applyRows(rows binlogRows) error {
+	switch rows.eventType {
+	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		// With binlog_row_image MINIMAL the before image only holds the key, and the after image the changed columns
+		for i := 0; i+1 < len(rows.Rows); i += 2 {
+			keyRow, _, err := a.row(rows.Rows[i], rows.SkippedColumns[i])
+			if err != nil {
+				return err
+			}
+			row, unchanged, err := a.row(rows.Rows[i+1], rows.SkippedColumns[i+1])
+			if err != nil {
+				return err
+			}
+			if err = a.update(keyRow, row, unchanged); err != nil {
+				return err
+			}
+		}
+	default:
+		deleted := rows.eventType == replication.DELETE_ROWS_EVENTv1 || rows.eventType == replication.DELETE_ROWS_EVENTv2
+		for i, image := range rows.Rows {
+			row, _, err := a.row(image, rows.SkippedColumns[i])
+			if err != nil {
+				return err
+			}
+			a.set(row, deleted)
+		}
+	}
+	return nil
+}
+
+// row converts a row image into a model table row, and returns the positions of columns missing from the image.
+func (a *binlogApplier) row(image []any, skipped []int) ([]driver.Value, []int, error) {
+	row := make([]driver.Value, len(a.columnIndexes)+1)
+	row[0] = a.r.Source.Name
+	unchanged := make([]int, 0)
+	for i, index := range a.columnIndexes {
+		if slices.Contains(skipped, index) {
+			unchanged = append(unchanged, i+1)
+			continue
+		}
+		value, err := a.columns[index].value(image[index])
+		if err != nil {
+			return nil, nil, err
+		}
+		row[i+1] = value
+	}
+	return row, unchanged, nil
+}
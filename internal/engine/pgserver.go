@@ -0,0 +1,793 @@
+package engine
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// Postgres type OIDs for the DuckDB types preen returns, https://github.com/postgres/postgres/blob/master/src/include/catalog/pg_type.dat
+const (
+	pgBoolOID        = 16
+	pgByteaOID       = 17
+	pgInt8OID        = 20
+	pgInt2OID        = 21
+	pgInt4OID        = 23
+	pgTextOID        = 25
+	pgJSONOID        = 114
+	pgFloat4OID      = 700
+	pgFloat8OID      = 701
+	pgDateOID        = 1082
+	pgTimeOID        = 1083
+	pgTimestampOID   = 1114
+	pgTimestamptzOID = 1184
+	pgIntervalOID    = 1186
+	pgTimetzOID      = 1266
+	pgNumericOID     = 1700
+	pgUUIDOID        = 2950
+)
+
+// Clients send these statements when connecting or around queries. DuckDB either does not
+// support them or they have no meaning for the per-query connections preen uses, so they are
+// acknowledged without being executed.
+var pgNoopCommands = map[string]string{
+	"SET":        "SET",
+	"RESET":      "RESET",
+	"DISCARD":    "DISCARD ALL",
+	"DEALLOCATE": "DEALLOCATE",
+	"BEGIN":      "BEGIN",
+	"START":      "START TRANSACTION",
+	"COMMIT":     "COMMIT",
+	"END":        "COMMIT",
+	"ROLLBACK":   "ROLLBACK",
+}
+
+// Rows are flushed to the client every pgFlushRows rows
+const pgFlushRows = 1000
+
+type pgStatement struct {
+	query     string
+	paramOIDs []uint32
+}
+
+// pgPortal is a statement with bound parameters. Its rows are streamed to the client, and a portal
+// that has been executed without returning rows, e.g. a SET, has a nil stream.
+type pgPortal struct {
+	query    string
+	executed bool
+	stream   *QueryStream
+	// rowCount is the number of rows an INSERT, UPDATE or DELETE changed
+	rowCount int
+}
+
+func (p *pgPortal) columns() ([]string, []string) {
+	if p.stream == nil {
+		return nil, nil
+	}
+	return p.stream.Columns, p.stream.ColumnTypes
+}
+
+func (p *pgPortal) close() {
+	if p.stream != nil {
+		p.stream.Close()
+		p.stream = nil
+	}
+}
+
+// pgSession is a single client connection speaking the Postgres wire protocol.
+type pgSession struct {
+	conn       net.Conn
+	password   string
+	backend    *pgproto3.Backend
+	statements map[string]pgStatement
+	portals    map[string]*pgPortal
+	// After an error in the extended query protocol, messages are discarded until the next Sync
+	failed bool
+}
+
+// ServePostgres serves the preen DuckDB database over the Postgres wire protocol, so psql and BI tools
+// can query the built models. Statements are executed through StreamQuery. Clients authenticate with
+// the password if one is set, and the server only listens on non-loopback addresses with a password.
+func ServePostgres(addr string, password string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	defer listener.Close()
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok && !tcpAddr.IP.IsLoopback() && password == "" {
+		return fmt.Errorf("refusing to serve on non-loopback address %s without a password. Set --pg-password or PREEN_PG_PASSWORD", listener.Addr())
+	}
+	Info(fmt.Sprintf("Serving preen models over the Postgres wire protocol on %s", listener.Addr()))
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			s := &pgSession{
+				conn:       conn,
+				password:   password,
+				backend:    pgproto3.NewBackend(conn, conn),
+				statements: make(map[string]pgStatement),
+				portals:    make(map[string]*pgPortal),
+			}
+			defer s.closePortals()
+			if err := s.serve(); err != nil {
+				Errorf("Error serving postgres client %s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *pgSession) serve() error {
+	if ok, err := s.startup(); err != nil || !ok {
+		return err
+	}
+	Debug(fmt.Sprintf("Postgres client connected from %s", s.conn.RemoteAddr()))
+
+	for {
+		msg, err := s.backend.Receive()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		if _, ok := msg.(*pgproto3.Terminate); ok {
+			return nil
+		}
+		if _, ok := msg.(*pgproto3.Sync); ok {
+			s.failed = false
+			s.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		} else if !s.failed {
+			if err = s.handleMessage(msg); err != nil {
+				s.sendError(err)
+				if _, ok := msg.(*pgproto3.Query); ok {
+					s.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+				} else {
+					s.failed = true
+				}
+			}
+		}
+
+		if err = s.backend.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// startup negotiates the connection. SSL and GSS encryption are declined. Without a password every
+// user is trusted, the server then only listens on a loopback address.
+func (s *pgSession) startup() (bool, error) {
+	for {
+		msg, err := s.backend.ReceiveStartupMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return false, nil
+			}
+			return false, err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			if _, err = s.conn.Write([]byte("N")); err != nil {
+				return false, err
+			}
+		case *pgproto3.CancelRequest:
+			// Queries are not cancellable, the connection is closed
+			return false, nil
+		case *pgproto3.StartupMessage:
+			if s.password != "" {
+				if ok, err := s.authenticate(msg.Parameters["user"]); err != nil || !ok {
+					return false, err
+				}
+			}
+			s.backend.Send(&pgproto3.AuthenticationOk{})
+			parameters := map[string]string{
+				"server_version":              "15.0",
+				"server_encoding":             "UTF8",
+				"client_encoding":             "UTF8",
+				"DateStyle":                   "ISO, MDY",
+				"TimeZone":                    "UTC",
+				"integer_datetimes":           "on",
+				"standard_conforming_strings": "on",
+				"application_name":            msg.Parameters["application_name"],
+			}
+			for name, value := range parameters {
+				s.backend.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+			}
+			s.backend.Send(&pgproto3.BackendKeyData{ProcessID: uint32(os.Getpid())})
+			s.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			return true, s.backend.Flush()
+		default:
+			return false, fmt.Errorf("unexpected startup message %T", msg)
+		}
+	}
+}
+
+// authenticate asks the client for the MD5 hash of its password, so the password is not sent in
+// clear text over the unencrypted connection. A wrong password ends the connection.
+func (s *pgSession) authenticate(user string) (bool, error) {
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return false, err
+	}
+	if err := s.backend.SetAuthType(pgproto3.AuthTypeMD5Password); err != nil {
+		return false, err
+	}
+	s.backend.Send(&pgproto3.AuthenticationMD5Password{Salt: salt})
+	if err := s.backend.Flush(); err != nil {
+		return false, err
+	}
+
+	msg, err := s.backend.Receive()
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	password, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		return false, fmt.Errorf("unexpected authentication message %T", msg)
+	}
+	expected := pgMD5Password(s.password, user, salt)
+	if subtle.ConstantTimeCompare([]byte(password.Password), []byte(expected)) == 1 {
+		return true, nil
+	}
+
+	Debug(fmt.Sprintf("Postgres client %s failed to authenticate as %s", s.conn.RemoteAddr(), user))
+	s.backend.Send(&pgproto3.ErrorResponse{
+		Severity: "FATAL",
+		// 28P01 is invalid_password
+		Code:    "28P01",
+		Message: fmt.Sprintf("password authentication failed for user %q", user),
+	})
+	return false, s.backend.Flush()
+}
+
+// pgMD5Password returns the response a client sends to an MD5 password request, the md5 prefixed hash
+// of the hashed password and user followed by the salt.
+func pgMD5Password(password string, user string, salt [4]byte) string {
+	hash := md5.Sum([]byte(password + user))
+	hash = md5.Sum(append([]byte(hex.EncodeToString(hash[:])), salt[:]...))
+	return "md5" + hex.EncodeToString(hash[:])
+}
+
+func (s *pgSession) handleMessage(msg pgproto3.FrontendMessage) error {
+	switch msg := msg.(type) {
+	case *pgproto3.Query:
+		return s.handleSimpleQuery(msg.String)
+	case *pgproto3.Parse:
+		s.statements[msg.Name] = pgStatement{query: msg.Query, paramOIDs: msg.ParameterOIDs}
+		s.backend.Send(&pgproto3.ParseComplete{})
+	case *pgproto3.Bind:
+		return s.handleBind(msg)
+	case *pgproto3.Describe:
+		return s.handleDescribe(msg)
+	case *pgproto3.Execute:
+		return s.handleExecute(msg)
+	case *pgproto3.Close:
+		if msg.ObjectType == 'S' {
+			delete(s.statements, msg.Name)
+		} else {
+			s.closePortal(msg.Name)
+		}
+		s.backend.Send(&pgproto3.CloseComplete{})
+	case *pgproto3.Flush:
+		// Flushed after every message
+	default:
+		return fmt.Errorf("unsupported message %T", msg)
+	}
+	return nil
+}
+
+func (s *pgSession) handleSimpleQuery(query string) error {
+	if strings.TrimSpace(strings.Trim(strings.TrimSpace(query), ";")) == "" {
+		s.backend.Send(&pgproto3.EmptyQueryResponse{})
+		s.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		return nil
+	}
+	portal := &pgPortal{query: query}
+	defer portal.close()
+	if err := s.executePortal(portal); err != nil {
+		return err
+	}
+	if columns, columnTypes := portal.columns(); len(columns) > 0 {
+		s.backend.Send(pgRowDescription(columns, columnTypes))
+	}
+	if err := s.sendRows(portal); err != nil {
+		return err
+	}
+	s.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	return nil
+}
+
+func (s *pgSession) handleBind(msg *pgproto3.Bind) error {
+	statement, ok := s.statements[msg.PreparedStatement]
+	if !ok {
+		return fmt.Errorf("prepared statement %q does not exist", msg.PreparedStatement)
+	}
+	literals := make([]string, len(msg.Parameters))
+	for i, param := range msg.Parameters {
+		if param == nil {
+			literals[i] = "null"
+			continue
+		}
+		if pgFormatCode(msg.ParameterFormatCodes, i) != 0 {
+			return fmt.Errorf("binary parameters are not supported")
+		}
+		var oid uint32
+		if i < len(statement.paramOIDs) {
+			oid = statement.paramOIDs[i]
+		}
+		literal, err := pgParamLiteral(string(param), oid)
+		if err != nil {
+			return fmt.Errorf("error parsing parameter $%d: %w", i+1, err)
+		}
+		literals[i] = literal
+	}
+	s.closePortal(msg.DestinationPortal)
+	s.portals[msg.DestinationPortal] = &pgPortal{query: pgBindLiterals(statement.query, literals)}
+	s.backend.Send(&pgproto3.BindComplete{})
+	return nil
+}
+
+func (s *pgSession) handleDescribe(msg *pgproto3.Describe) error {
+	if msg.ObjectType == 'S' {
+		statement, ok := s.statements[msg.Name]
+		if !ok {
+			return fmt.Errorf("prepared statement %q does not exist", msg.Name)
+		}
+		// Parameters the client did not declare are reported as unspecified, OID 0
+		paramOIDs := make([]uint32, pgParamCount(statement.query))
+		copy(paramOIDs, statement.paramOIDs)
+		s.backend.Send(&pgproto3.ParameterDescription{ParameterOIDs: paramOIDs})
+		s.backend.Send(s.describeStatement(statement.query, len(paramOIDs)))
+		return nil
+	}
+
+	portal, ok := s.portals[msg.Name]
+	if !ok {
+		return fmt.Errorf("portal %q does not exist", msg.Name)
+	}
+	// The portal is executed to describe its rows, Execute then streams them
+	if err := s.executePortal(portal); err != nil {
+		return err
+	}
+	if columns, columnTypes := portal.columns(); len(columns) > 0 {
+		s.backend.Send(pgRowDescription(columns, columnTypes))
+	} else {
+		s.backend.Send(&pgproto3.NoData{})
+	}
+	return nil
+}
+
+// describeStatement describes the rows of a statement before its parameters are bound, by running
+// it with null parameters and no rows. Statements that can not be described report no data.
+func (s *pgSession) describeStatement(query string, paramCount int) pgproto3.BackendMessage {
+	keyword := pgCommandKeyword(query)
+	if keyword != "SELECT" && keyword != "WITH" && keyword != "TABLE" && keyword != "VALUES" {
+		return &pgproto3.NoData{}
+	}
+	literals := make([]string, paramCount)
+	for i := range literals {
+		literals[i] = "null"
+	}
+	query = strings.TrimSuffix(strings.TrimSpace(pgBindLiterals(query, literals)), ";")
+	results, err := Execute(fmt.Sprintf("select * from (%s) limit 0", query))
+	if err != nil || len(results.Columns) == 0 {
+		return &pgproto3.NoData{}
+	}
+	return pgRowDescription(results.Columns, results.ColumnTypes)
+}
+
+func (s *pgSession) handleExecute(msg *pgproto3.Execute) error {
+	portal, ok := s.portals[msg.Portal]
+	if !ok {
+		return fmt.Errorf("portal %q does not exist", msg.Portal)
+	}
+	// Portals run to completion, so they can not be resumed
+	defer s.closePortal(msg.Portal)
+	if err := s.executePortal(portal); err != nil {
+		return err
+	}
+	return s.sendRows(portal)
+}
+
+// executePortal starts the portal's query once. Its rows are read by sendRows.
+func (s *pgSession) executePortal(portal *pgPortal) error {
+	if portal.executed {
+		return nil
+	}
+	portal.executed = true
+	if _, ok := pgNoopCommands[pgCommandKeyword(portal.query)]; ok {
+		Debug(fmt.Sprintf("Ignoring postgres client statement: %s", portal.query))
+		return nil
+	}
+	stream, err := StreamQuery(portal.query)
+	if err != nil {
+		return err
+	}
+	// DuckDB returns the number of changed rows as a Count column, Postgres reports it in the command tag
+	if pgChangesRows(portal.query) && len(stream.Columns) == 1 && stream.Columns[0] == "Count" {
+		defer stream.Close()
+		if stream.Next() {
+			count, _ := stream.Values()[0].(int64)
+			portal.rowCount = int(count)
+		}
+		return stream.Err()
+	}
+	portal.stream = stream
+	return nil
+}
+
+// sendRows streams the portal's rows to the client as they are read from DuckDB. The backend buffers
+// messages until flushed, so rows are flushed in batches to keep memory constant.
+func (s *pgSession) sendRows(portal *pgPortal) error {
+	columns, columnTypes := portal.columns()
+	rowCount := portal.rowCount
+	if portal.stream != nil {
+		for portal.stream.Next() {
+			values := make([][]byte, len(columns))
+			for i, value := range portal.stream.Values() {
+				values[i] = pgTextValue(value, columnTypes[i])
+			}
+			s.backend.Send(&pgproto3.DataRow{Values: values})
+			rowCount++
+			if rowCount%pgFlushRows == 0 {
+				if err := s.backend.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := portal.stream.Err(); err != nil {
+			return err
+		}
+	}
+	s.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(pgCommandTag(portal.query, columns, rowCount))})
+	return nil
+}
+
+func (s *pgSession) closePortal(name string) {
+	if portal, ok := s.portals[name]; ok {
+		portal.close()
+		delete(s.portals, name)
+	}
+}
+
+func (s *pgSession) closePortals() {
+	for name := range s.portals {
+		s.closePortal(name)
+	}
+}
+
+func (s *pgSession) sendError(err error) {
+	Debug(fmt.Sprintf("Postgres client query error: %s", err))
+	s.backend.Send(&pgproto3.ErrorResponse{
+		Severity: "ERROR",
+		// XX000 is internal_error, DuckDB errors do not map to specific SQLSTATE codes
+		Code:    "XX000",
+		Message: err.Error(),
+	})
+}
+
+func pgRowDescription(columns []string, columnTypes []string) *pgproto3.RowDescription {
+	fields := make([]pgproto3.FieldDescription, len(columns))
+	for i, column := range columns {
+		oid, size := pgTypeOID(columnTypes[i])
+		fields[i] = pgproto3.FieldDescription{
+			Name:         []byte(column),
+			DataTypeOID:  oid,
+			DataTypeSize: size,
+			TypeModifier: -1,
+			Format:       0,
+		}
+	}
+	return &pgproto3.RowDescription{Fields: fields}
+}
+
+// pgCommandKeyword returns the upper case first keyword of a statement.
+func pgCommandKeyword(query string) string {
+	fields := strings.Fields(strings.TrimLeft(strings.TrimSpace(query), "("))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSuffix(fields[0], ";"))
+}
+
+// pgChangesRows reports whether a statement inserts, updates or deletes rows.
+func pgChangesRows(query string) bool {
+	switch pgCommandKeyword(query) {
+	case "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// pgCommandTag returns the tag of a completed statement. Statements that change rows report the number
+// of rows changed, or returned with a RETURNING clause, and INSERT also reports the legacy OID 0.
+func pgCommandTag(query string, columns []string, rowCount int) string {
+	keyword := pgCommandKeyword(query)
+	if tag, ok := pgNoopCommands[keyword]; ok {
+		return tag
+	}
+	switch keyword {
+	case "INSERT":
+		return fmt.Sprintf("INSERT 0 %d", rowCount)
+	case "UPDATE", "DELETE":
+		return fmt.Sprintf("%s %d", keyword, rowCount)
+	}
+	if len(columns) > 0 {
+		return fmt.Sprintf("SELECT %d", rowCount)
+	}
+	return keyword
+}
+
+func pgParamCount(query string) int {
+	count := 0
+	pgReplaceParams(query, func(n int, placeholder string) string {
+		count = max(count, n)
+		return placeholder
+	})
+	return count
+}
+
+// pgReplaceParams calls replace with every $n placeholder of a query and substitutes its result.
+// String literals, quoted identifiers, dollar quoted strings and comments are copied unchanged, so a
+// $1 inside them is not a placeholder.
+func pgReplaceParams(query string, replace func(n int, placeholder string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		end := i + 1
+		switch c := query[i]; {
+		case c == '"':
+			end = pgQuotedEnd(query, i, false)
+		case c == '\'':
+			// E'...' strings escape quotes with backslashes
+			escapeString := i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !pgIdentifierChar(query[i-2]))
+			end = pgQuotedEnd(query, i, escapeString)
+		case strings.HasPrefix(query[i:], "--"):
+			end = strings.IndexByte(query[i:], '\n')
+			end = pgSkipTo(query, i, end, 1)
+		case strings.HasPrefix(query[i:], "/*"):
+			end = strings.Index(query[i+2:], "*/")
+			end = pgSkipTo(query, i+2, end, 2)
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' && (i == 0 || !pgIdentifierChar(query[i-1])):
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			n, err := strconv.Atoi(query[i+1 : end])
+			if err != nil {
+				b.WriteString(query[i:end])
+			} else {
+				b.WriteString(replace(n, query[i:end]))
+			}
+			i = end
+			continue
+		case c == '$' && (i == 0 || !pgIdentifierChar(query[i-1])):
+			// A dollar quoted string, $$...$$ or $tag$...$tag$
+			tagEnd := i + 1
+			for tagEnd < len(query) && pgIdentifierChar(query[tagEnd]) && query[tagEnd] != '$' {
+				tagEnd++
+			}
+			if tagEnd < len(query) && query[tagEnd] == '$' {
+				tag := query[i : tagEnd+1]
+				end = pgSkipTo(query, tagEnd+1, strings.Index(query[tagEnd+1:], tag), len(tag))
+			}
+		}
+		b.WriteString(query[i:end])
+		i = end
+	}
+	return b.String()
+}
+
+// pgQuotedEnd returns the index after the quote closing the literal or identifier that starts at
+// start. Doubled quotes are escaped quotes, as are backslashes in E'...' strings.
+func pgQuotedEnd(query string, start int, backslashEscapes bool) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case backslashEscapes && query[i] == '\\':
+			i++
+		case query[i] == quote && i+1 < len(query) && query[i+1] == quote:
+			i++
+		case query[i] == quote:
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// pgSkipTo returns the index after a terminator of length n found at offset index from start, or the
+// end of the query if it was not found.
+func pgSkipTo(query string, start int, index int, n int) int {
+	if index < 0 {
+		return len(query)
+	}
+	return start + index + n
+}
+
+func pgIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func pgFormatCode(formatCodes []int16, i int) int16 {
+	switch len(formatCodes) {
+	case 0:
+		return 0
+	case 1:
+		return formatCodes[0]
+	default:
+		return formatCodes[i]
+	}
+}
+
+// pgParamLiteral converts a text format parameter to a SQL literal of its declared OID. Parameters
+// without a declared type become string literals, which DuckDB implicitly casts to the type they are
+// compared with, where a bound VARCHAR parameter would require an explicit cast.
+func pgParamLiteral(param string, oid uint32) (string, error) {
+	switch oid {
+	case pgInt2OID, pgInt4OID, pgInt8OID:
+		if _, err := strconv.ParseInt(param, 10, 64); err != nil {
+			return "", err
+		}
+		return param, nil
+	case pgFloat4OID, pgFloat8OID, pgNumericOID:
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			return "", err
+		}
+		return param, nil
+	case pgBoolOID:
+		b, err := strconv.ParseBool(param)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(param, "'", "''")), nil
+	}
+}
+
+// pgBindLiterals replaces the $n placeholders of a query with their literals.
+func pgBindLiterals(query string, literals []string) string {
+	return pgReplaceParams(query, func(n int, placeholder string) string {
+		if n < 1 || n > len(literals) {
+			return placeholder
+		}
+		return literals[n-1]
+	})
+}
+
+// pgTypeOID maps a DuckDB type name to its Postgres type OID and size. Types without a
+// Postgres equivalent, e.g. lists and structs, are sent as text.
+func pgTypeOID(typeName string) (uint32, int16) {
+	if strings.HasPrefix(typeName, "DECIMAL") {
+		return pgNumericOID, -1
+	}
+	switch typeName {
+	case "BOOLEAN":
+		return pgBoolOID, 1
+	case "TINYINT", "UTINYINT", "SMALLINT":
+		return pgInt2OID, 2
+	case "USMALLINT", "INTEGER":
+		return pgInt4OID, 4
+	case "UINTEGER", "BIGINT":
+		return pgInt8OID, 8
+	case "UBIGINT", "HUGEINT", "UHUGEINT", "VARINT":
+		return pgNumericOID, -1
+	case "FLOAT":
+		return pgFloat4OID, 4
+	case "DOUBLE":
+		return pgFloat8OID, 8
+	case "BLOB":
+		return pgByteaOID, -1
+	case "DATE":
+		return pgDateOID, 4
+	case "TIME":
+		return pgTimeOID, 8
+	case "TIMETZ":
+		return pgTimetzOID, 12
+	case "TIMESTAMP", "TIMESTAMP_S", "TIMESTAMP_MS", "TIMESTAMP_NS":
+		return pgTimestampOID, 8
+	case "TIMESTAMPTZ":
+		return pgTimestamptzOID, 8
+	case "INTERVAL":
+		return pgIntervalOID, 16
+	case "UUID":
+		return pgUUIDOID, 16
+	case "JSON":
+		return pgJSONOID, -1
+	default:
+		return pgTextOID, -1
+	}
+}
+
+// pgTextValue encodes a DuckDB value in the Postgres text format.
+func pgTextValue(value any, typeName string) []byte {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		if v {
+			return []byte("t")
+		}
+		return []byte("f")
+	case []byte:
+		if typeName == "UUID" && len(v) == 16 {
+			h := hex.EncodeToString(v)
+			return []byte(fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]))
+		}
+		return []byte(`\x` + hex.EncodeToString(v))
+	case string:
+		return []byte(v)
+	case float32:
+		return []byte(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		switch typeName {
+		case "DATE":
+			return []byte(v.Format("2006-01-02"))
+		case "TIME":
+			return []byte(v.Format("15:04:05.999999"))
+		case "TIMETZ":
+			return []byte(v.Format("15:04:05.999999-07"))
+		case "TIMESTAMPTZ":
+			return []byte(v.Format("2006-01-02 15:04:05.999999-07"))
+		default:
+			return []byte(v.Format("2006-01-02 15:04:05.999999"))
+		}
+	case duckdb.Decimal:
+		return []byte(formatDecimal(v))
+	case duckdb.Interval:
+		duration := time.Duration(v.Micros) * time.Microsecond
+		hours := int64(duration / time.Hour)
+		minutes := int64(duration%time.Hour) / int64(time.Minute)
+		seconds := float64(duration%time.Minute) / float64(time.Second)
+		return []byte(fmt.Sprintf("%d mons %d days %02d:%02d:%09.6f", v.Months, v.Days, hours, minutes, seconds))
+	case *big.Int:
+		return []byte(v.String())
+	case map[string]any, []any, duckdb.Map:
+		jsonVal, err := json.Marshal(v)
+		if err != nil {
+			return []byte(fmt.Sprint(v))
+		}
+		return jsonVal
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// formatDecimal formats a DuckDB decimal without losing precision to a float conversion.
+func formatDecimal(d duckdb.Decimal) string {
+	digits := new(big.Int).Abs(d.Value).String()
+	sign := ""
+	if d.Value.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+	scale := int(d.Scale)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/marcboeker/go-duckdb"
+)
+
+func TestPgTextValue(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 14, 30, 15, 250000000, time.UTC)
+	tests := []struct {
+		name     string
+		value    any
+		typeName string
+		expected []byte
+	}{
+		{"null", nil, "INTEGER", nil},
+		{"bool", true, "BOOLEAN", []byte("t")},
+		{"integer", int32(42), "INTEGER", []byte("42")},
+		{"double", 1.5, "DOUBLE", []byte("1.5")},
+		{"date", ts, "DATE", []byte("2024-03-05")},
+		{"timestamp", ts, "TIMESTAMP", []byte("2024-03-05 14:30:15.25")},
+		{"timestamptz", ts, "TIMESTAMPTZ", []byte("2024-03-05 14:30:15.25+00")},
+		{"decimal", duckdb.Decimal{Width: 10, Scale: 2, Value: big.NewInt(-5)}, "DECIMAL(10,2)", []byte("-0.05")},
+		{"blob", []byte{0xde, 0xad}, "BLOB", []byte(`\xdead`)},
+		{"uuid", []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}, "UUID", []byte("12345678-9abc-def0-1234-56789abcdef0")},
+		{"interval", duckdb.Interval{Months: 1, Days: 2, Micros: 3723500000}, "INTERVAL", []byte("1 mons 2 days 01:02:03.500000")},
+		{"list", []any{int32(1), int32(2)}, "INTEGER[]", []byte("[1,2]")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := pgTextValue(tt.value, tt.typeName); string(result) != string(tt.expected) || (result == nil) != (tt.expected == nil) {
+				t.Errorf("pgTextValue(%v, %s) = %q; want %q", tt.value, tt.typeName, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPgBindLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		params   []string
+		oids     []uint32
+		expected string
+	}{
+		{"unspecified", "select * from t where id = $1", []string{"1"}, []uint32{0}, "select * from t where id = '1'"},
+		{"quoted", "select * from t where name = $1", []string{"o'neil"}, []uint32{pgTextOID}, "select * from t where name = 'o''neil'"},
+		{"typed", "select * from t where id = $2 and ok = $1", []string{"true", "7"}, []uint32{pgBoolOID, pgInt8OID}, "select * from t where id = 7 and ok = true"},
+		{"string literal", "select '$1', 'it''s $1' from t where id = $1", []string{"7"}, []uint32{pgInt8OID}, "select '$1', 'it''s $1' from t where id = 7"},
+		{"escape string", `select E'\'$1' from t where id = $1`, []string{"7"}, []uint32{pgInt8OID}, `select E'\'$1' from t where id = 7`},
+		{"quoted identifier", `select "price $1" from t where id = $1`, []string{"7"}, []uint32{pgInt8OID}, `select "price $1" from t where id = 7`},
+		{"dollar quoted", "select $$ $1 $$, $tag$ $1 $tag$ from t where id = $1", []string{"7"}, []uint32{pgInt8OID}, "select $$ $1 $$, $tag$ $1 $tag$ from t where id = 7"},
+		{"comments", "select 1 -- $1\nfrom t /* $1 */ where id = $1", []string{"7"}, []uint32{pgInt8OID}, "select 1 -- $1\nfrom t /* $1 */ where id = 7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literals := make([]string, len(tt.params))
+			for i, param := range tt.params {
+				literal, err := pgParamLiteral(param, tt.oids[i])
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				literals[i] = literal
+			}
+			if result := pgBindLiterals(tt.query, literals); result != tt.expected {
+				t.Errorf("pgBindLiterals() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+
+	if _, err := pgParamLiteral("1; drop table t", pgInt4OID); err == nil {
+		t.Errorf("expected error for invalid integer parameter, got nil")
+	}
+}
+
+func TestPgCommandTag(t *testing.T) {
+	tests := []struct {
+		query    string
+		columns  []string
+		rowCount int
+		expected string
+	}{
+		{"select id from t", []string{"id"}, 2, "SELECT 2"},
+		{"set extra_float_digits = 3", nil, 0, "SET"},
+		{"begin", nil, 0, "BEGIN"},
+		{"create table x (id int)", nil, 0, "CREATE"},
+		{"insert into t values (1), (2)", nil, 2, "INSERT 0 2"},
+		{"insert into t values (1) returning id", []string{"id"}, 1, "INSERT 0 1"},
+		{"update t set id = 2", nil, 3, "UPDATE 3"},
+		{"delete from t", nil, 0, "DELETE 0"},
+	}
+
+	for _, tt := range tests {
+		if result := pgCommandTag(tt.query, tt.columns, tt.rowCount); result != tt.expected {
+			t.Errorf("pgCommandTag(%s) = %s; want %s", tt.query, result, tt.expected)
+		}
+	}
+}
+
+func TestPgParamCount(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"select * from t where id = $2 and ok = $1", 2},
+		{"select '$3' from t where id = $1", 1},
+		{`select "$3", $$ $4 $$ from t`, 0},
+	}
+
+	for _, tt := range tests {
+		if result := pgParamCount(tt.query); result != tt.expected {
+			t.Errorf("pgParamCount(%s) = %d; want %d", tt.query, result, tt.expected)
+		}
+	}
+}
+
+func TestPgSessionAuthenticate(t *testing.T) {
+	Initialize()
+	tests := []struct {
+		name     string
+		password string
+		expected bool
+	}{
+		{"valid password", "secret", true},
+		{"invalid password", "wrong", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+			s := &pgSession{conn: serverConn, password: "secret", backend: pgproto3.NewBackend(serverConn, serverConn)}
+			result := make(chan bool, 1)
+			go func() {
+				ok, err := s.authenticate("preen")
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				result <- ok
+			}()
+
+			frontend := pgproto3.NewFrontend(clientConn, clientConn)
+			msg, err := frontend.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			request, ok := msg.(*pgproto3.AuthenticationMD5Password)
+			if !ok {
+				t.Fatalf("expected md5 password request, got %T", msg)
+			}
+			frontend.Send(&pgproto3.PasswordMessage{Password: pgMD5Password(tt.password, "preen", request.Salt)})
+			if err = frontend.Flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.expected {
+				if msg, err = frontend.Receive(); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if e, ok := msg.(*pgproto3.ErrorResponse); !ok || e.Code != "28P01" {
+					t.Errorf("expected invalid password error, got %+v", msg)
+				}
+			}
+			if ok := <-result; ok != tt.expected {
+				t.Errorf("authenticate() = %v; want %v", ok, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServePostgresRefusesRemoteAddressWithoutPassword(t *testing.T) {
+	Initialize()
+	err := ServePostgres("0.0.0.0:0", "")
+	if err == nil || !strings.Contains(err.Error(), "without a password") {
+		t.Errorf("expected non-loopback address error, got %v", err)
+	}
+}
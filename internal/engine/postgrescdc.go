@@ -0,0 +1,505 @@
+package engine
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// streamChanges retrieves a CDC model. Without a stored position the table is snapshotted, otherwise the
+// changes committed since the stored position are read from the replication slot. Inserted and updated
+// rows are sent to the staging table, deleted keys are kept on the retriever's progress.
+func (e *postgresEngine) streamChanges(r *Retriever, ic chan []driver.Value) error {
+	ctx := context.Background()
+	progress := r.CDC
+	if progress.position == "" {
+		return e.snapshotTable(r, ic)
+	}
+
+	var confirmedLSN *string
+	err := e.pool.QueryRow(ctx, "select confirmed_flush_lsn::text from pg_replication_slots where slot_name = $1", progress.slot).Scan(&confirmedLSN)
+	if errors.Is(err, pgx.ErrNoRows) {
+		Warn(fmt.Sprintf("Replication slot %s not found on source %s. Snapshotting %s again", progress.slot, r.Source.Name, r.ModelName))
+		return e.snapshotTable(r, ic)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading replication slot %s: %w", progress.slot, err)
+	}
+
+	// The slot is only advanced to positions stored by a successful build, so the changes of a failed
+	// build are read again. Postgres keeps the WAL of every change past the slot's position.
+	storedLSN, err := parseLSN(progress.position)
+	if err != nil {
+		return err
+	}
+	if confirmedLSN == nil || mustParseLSN(*confirmedLSN) < storedLSN {
+		if _, err = e.pool.Exec(ctx, "select pg_replication_slot_advance($1, $2::pg_lsn)", progress.slot, progress.position); err != nil {
+			return fmt.Errorf("error advancing replication slot %s: %w", progress.slot, err)
+		}
+	}
+
+	// Changes are read up to the current position, so a busy table can not keep the build running
+	if err = e.pool.QueryRow(ctx, "select pg_current_wal_lsn()::text").Scan(&progress.endPosition); err != nil {
+		return fmt.Errorf("error reading current wal position: %w", err)
+	}
+	rows, err := e.pool.Query(
+		ctx,
+		"select data from pg_logical_slot_peek_binary_changes($1, $2::pg_lsn, null, 'proto_version', '1', 'publication_names', $3)",
+		progress.slot, progress.endPosition, progress.publication,
+	)
+	if err != nil {
+		return fmt.Errorf("error reading changes from replication slot %s: %w", progress.slot, err)
+	}
+	defer rows.Close()
+
+	applier := newPgoutputApplier(r)
+	defer applier.close()
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return err
+		}
+		if err = applier.apply(data); err != nil {
+			return fmt.Errorf("error applying change from replication slot %s: %w", progress.slot, err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	applier.flush(ic)
+	return nil
+}
+
+// snapshotTable retrieves every row of the model and creates the replication slot the next build reads
+// changes from. The slot is created before the table is read. Changes committed while the table is
+// read are replayed by the next build, which is harmless as changes are applied by primary key.
+func (e *postgresEngine) snapshotTable(r *Retriever, ic chan []driver.Value) error {
+	ctx := context.Background()
+	progress := r.CDC
+	Info(fmt.Sprintf("Snapshotting %s from %s for change data capture", r.ModelName, r.Source.Name))
+
+	// A previous slot's changes are superseded by the snapshot
+	if _, err := e.pool.Exec(ctx, "select pg_drop_replication_slot(slot_name) from pg_replication_slots where slot_name = $1", progress.slot); err != nil {
+		return fmt.Errorf("error dropping replication slot %s: %w", progress.slot, err)
+	}
+
+	var publicationExists bool
+	if err := e.pool.QueryRow(ctx, "select exists (select 1 from pg_publication where pubname = $1)", progress.publication).Scan(&publicationExists); err != nil {
+		return fmt.Errorf("error reading publication %s: %w", progress.publication, err)
+	}
+	if !publicationExists {
+		createPublicationStmt := fmt.Sprintf(
+			"create publication %s for table %s",
+			pgx.Identifier{progress.publication}.Sanitize(),
+			pgx.Identifier{progress.config.tableSchema(postgresDefaultSchema(e.source)), progress.config.table}.Sanitize(),
+		)
+		if _, err := e.pool.Exec(ctx, createPublicationStmt); err != nil {
+			return fmt.Errorf("error creating publication %s: %w", progress.publication, err)
+		}
+	}
+
+	if err := e.pool.QueryRow(ctx, "select lsn::text from pg_create_logical_replication_slot($1, 'pgoutput')", progress.slot).Scan(&progress.endPosition); err != nil {
+		return fmt.Errorf("error creating replication slot %s: %w", progress.slot, err)
+	}
+	progress.replace = true
+
+	if err := e.checkReplicaIdentity(progress.config); err != nil {
+		return err
+	}
+	rows, err := e.pool.Query(ctx, r.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return processPostgresRows(r, ic, rows)
+}
+
+// checkReplicaIdentity reads the replica identity of the replicated table, so a snapshot fails before
+// its changes are read if deletes and key changes can not be applied.
+func (e *postgresEngine) checkReplicaIdentity(config *CDC) error {
+	var identity string
+	var keyColumns []string
+	err := e.pool.QueryRow(context.Background(), `
+		select c.relreplident::text, coalesce(array_agg(a.attname::text) filter (where a.attname is not null), '{}')
+		from pg_class c
+		join pg_namespace n on n.oid = c.relnamespace
+		left join pg_index i on i.indrelid = c.oid
+			and ((c.relreplident = 'd' and i.indisprimary) or (c.relreplident = 'i' and i.indisreplident))
+		left join pg_attribute a on a.attrelid = c.oid and a.attnum = any(i.indkey)
+		where n.nspname = $1 and c.relname = $2
+		group by c.relreplident`,
+		config.tableSchema(postgresDefaultSchema(e.source)), config.table,
+	).Scan(&identity, &keyColumns)
+	if err != nil {
+		return fmt.Errorf("error reading replica identity of %s: %w", config.table, err)
+	}
+	return checkReplicaIdentity(config, identity[0], keyColumns)
+}
+
+// checkReplicaIdentity checks that the old tuple of updates and deletes holds every primary_key column.
+// Postgres only sends the replica identity columns, the table's primary key by default, unless the
+// table has REPLICA IDENTITY FULL. Other key columns would be null and the changes silently lost.
+func checkReplicaIdentity(config *CDC, identity byte, keyColumns []string) error {
+	if identity == 'f' {
+		return nil
+	}
+	for _, key := range config.PrimaryKey {
+		column := config.columns[slices.Index(config.aliases, key)]
+		if !slices.Contains(keyColumns, column) {
+			return fmt.Errorf(
+				"primary_key column %s is not part of the replica identity of table %s. Use the table's primary key or run alter table %s replica identity full",
+				key, config.table, config.table,
+			)
+		}
+	}
+	return nil
+}
+
+// pgoutputApplier folds the pgoutput messages of the replicated table into the latest state of every changed row.
+type pgoutputApplier struct {
+	*cdcChanges
+	schema   string
+	relation *pgoutputRelation
+	// Position of every model column in the replicated table's tuples
+	columnIndexes []int
+	typeMap       *pgtype.Map
+}
+
+func newPgoutputApplier(r *Retriever) *pgoutputApplier {
+	return &pgoutputApplier{
+		cdcChanges: newCDCChanges(r),
+		schema:     r.CDC.config.tableSchema(postgresDefaultSchema(r.Source)),
+		typeMap:    pgtype.NewMap(),
+	}
+}
+
+func (a *pgoutputApplier) apply(data []byte) error {
+	msg, err := parsePgoutputMessage(data)
+	if err != nil {
+		return err
+	}
+	switch msg := msg.(type) {
+	case *pgoutputRelation:
+		if msg.namespace == a.schema && msg.name == a.r.CDC.config.table {
+			return a.setRelation(msg)
+		}
+	case *pgoutputInsert:
+		if a.isTable(msg.relationID) {
+			row, _, err := a.row(msg.tuple)
+			if err != nil {
+				return err
+			}
+			a.set(row, false)
+		}
+	case *pgoutputUpdate:
+		if a.isTable(msg.relationID) {
+			return a.applyUpdate(msg)
+		}
+	case *pgoutputDelete:
+		if a.isTable(msg.relationID) {
+			row, _, err := a.row(msg.oldTuple)
+			if err != nil {
+				return err
+			}
+			a.set(row, true)
+		}
+	case *pgoutputTruncate:
+		if a.relation != nil && slices.Contains(msg.relationIDs, a.relation.id) {
+			a.truncate()
+		}
+	}
+	return nil
+}
+
+func (a *pgoutputApplier) isTable(relationID uint32) bool {
+	return a.relation != nil && a.relation.id == relationID
+}
+
+func (a *pgoutputApplier) setRelation(relation *pgoutputRelation) error {
+	keyColumns := make([]string, 0)
+	for _, column := range relation.columns {
+		if column.key {
+			keyColumns = append(keyColumns, column.name)
+		}
+	}
+	if err := checkReplicaIdentity(a.r.CDC.config, relation.replicaIdentity, keyColumns); err != nil {
+		return err
+	}
+	a.relation = relation
+	a.columnIndexes = make([]int, len(a.r.CDC.config.columns))
+	for i, column := range a.r.CDC.config.columns {
+		a.columnIndexes[i] = slices.IndexFunc(relation.columns, func(c pgoutputColumn) bool { return c.name == column })
+		if a.columnIndexes[i] == -1 {
+			return fmt.Errorf("column %s not found in replicated table %s.%s", column, relation.namespace, relation.name)
+		}
+	}
+	return nil
+}
+
+// applyUpdate replaces the row. The new tuple omits TOAST columns whose value did not change, those are
+// taken from the row's previous state. The old tuple is only sent if the key changed, or the table
+// has REPLICA IDENTITY FULL.
+func (a *pgoutputApplier) applyUpdate(msg *pgoutputUpdate) error {
+	row, unchanged, err := a.row(msg.newTuple)
+	if err != nil {
+		return err
+	}
+	keyRow := row
+	if msg.oldTuple != nil {
+		if keyRow, _, err = a.row(msg.oldTuple); err != nil {
+			return err
+		}
+	}
+	return a.update(keyRow, row, unchanged)
+}
+
+// row converts a tuple into a model table row, and returns the positions of unchanged TOAST values.
+func (a *pgoutputApplier) row(tuple pgoutputTuple) ([]driver.Value, []int, error) {
+	row := make([]driver.Value, len(a.columnIndexes)+1)
+	row[0] = a.r.Source.Name
+	unchanged := make([]int, 0)
+	for i, index := range a.columnIndexes {
+		if index >= len(tuple) {
+			return nil, nil, fmt.Errorf("tuple has %d columns, expected at least %d", len(tuple), index+1)
+		}
+		switch tuple[index].kind {
+		case 'n':
+			row[i+1] = nil
+		case 'u':
+			unchanged = append(unchanged, i+1)
+		case 't':
+			value, err := a.decode(a.relation.columns[index].typeOID, tuple[index].data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error decoding column %s: %w", a.relation.columns[index].name, err)
+			}
+			row[i+1] = value
+		default:
+			return nil, nil, fmt.Errorf("unsupported tuple data kind %q", tuple[index].kind)
+		}
+	}
+	return row, unchanged, nil
+}
+
+// decode converts a text value into the type pgx decodes the column's type to, so changes are
+// inserted like the rows of a snapshot.
+func (a *pgoutputApplier) decode(typeOID uint32, data []byte) (driver.Value, error) {
+	dataType, ok := a.typeMap.TypeForOID(typeOID)
+	if !ok {
+		return string(data), nil
+	}
+	value, err := dataType.Codec.DecodeValue(a.typeMap, typeOID, pgtype.TextFormatCode, data)
+	if err != nil {
+		return nil, err
+	}
+	return postgresDriverValue(value)
+}
+
+// parseLSN parses a postgres WAL position such as 16/B374D848.
+func parseLSN(lsn string) (uint64, error) {
+	hi, lo, ok := strings.Cut(lsn, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid lsn %s", lsn)
+	}
+	hiVal, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %s: %w", lsn, err)
+	}
+	loVal, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %s: %w", lsn, err)
+	}
+	return hiVal<<32 | loVal, nil
+}
+
+// mustParseLSN parses a position reported by postgres itself.
+func mustParseLSN(lsn string) uint64 {
+	value, _ := parseLSN(lsn)
+	return value
+}
+
+// The pgoutput logical replication messages preen applies, see
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html.
+// Begin, commit, origin, type and logical decoding messages are skipped.
+
+type pgoutputColumn struct {
+	name    string
+	typeOID uint32
+	// Part of the replica identity, sent in the old tuple of updates and deletes
+	key bool
+}
+
+type pgoutputRelation struct {
+	id        uint32
+	namespace string
+	name      string
+	// REPLICA IDENTITY setting, d (primary key), n (nothing), f (full) or i (index)
+	replicaIdentity byte
+	columns         []pgoutputColumn
+}
+
+type pgoutputTupleColumn struct {
+	// n is null, u is an unchanged TOAST value, t is text
+	kind byte
+	data []byte
+}
+
+type pgoutputTuple []pgoutputTupleColumn
+
+type pgoutputInsert struct {
+	relationID uint32
+	tuple      pgoutputTuple
+}
+
+type pgoutputUpdate struct {
+	relationID uint32
+	// The old key or old row, only sent if the key changed or the table has REPLICA IDENTITY FULL
+	oldTuple pgoutputTuple
+	newTuple pgoutputTuple
+}
+
+type pgoutputDelete struct {
+	relationID uint32
+	oldTuple   pgoutputTuple
+}
+
+type pgoutputTruncate struct {
+	relationIDs []uint32
+}
+
+type pgoutputReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("pgoutput message truncated at byte %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *pgoutputReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := slices.Index(r.data[r.pos:], 0)
+	if end == -1 {
+		r.err = fmt.Errorf("pgoutput string not terminated at byte %d", r.pos)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s
+}
+
+func (r *pgoutputReader) tuple() pgoutputTuple {
+	tuple := make(pgoutputTuple, r.uint16())
+	for i := range tuple {
+		tuple[i].kind = r.byte()
+		if tuple[i].kind == 't' || tuple[i].kind == 'b' {
+			tuple[i].data = r.next(int(r.uint32()))
+		}
+	}
+	return tuple
+}
+
+// parsePgoutputMessage decodes a protocol version 1 pgoutput message. Messages preen does not apply are returned as nil.
+func parsePgoutputMessage(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty pgoutput message")
+	}
+	r := &pgoutputReader{data: data, pos: 1}
+	var msg any
+	switch data[0] {
+	case 'R':
+		relation := &pgoutputRelation{id: r.uint32(), namespace: r.string(), name: r.string()}
+		relation.replicaIdentity = r.byte()
+		relation.columns = make([]pgoutputColumn, r.uint16())
+		for i := range relation.columns {
+			// Flags, 1 marks key columns
+			relation.columns[i].key = r.byte()&1 == 1
+			relation.columns[i].name = r.string()
+			relation.columns[i].typeOID = r.uint32()
+			// Type modifier
+			r.uint32()
+		}
+		msg = relation
+	case 'I':
+		insert := &pgoutputInsert{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("unexpected insert tuple type %q", kind)
+		}
+		insert.tuple = r.tuple()
+		msg = insert
+	case 'U':
+		update := &pgoutputUpdate{relationID: r.uint32()}
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			update.oldTuple = r.tuple()
+			kind = r.byte()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("unexpected update tuple type %q", kind)
+		}
+		update.newTuple = r.tuple()
+		msg = update
+	case 'D':
+		del := &pgoutputDelete{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'K' && kind != 'O' && r.err == nil {
+			return nil, fmt.Errorf("unexpected delete tuple type %q", kind)
+		}
+		del.oldTuple = r.tuple()
+		msg = del
+	case 'T':
+		truncate := &pgoutputTruncate{relationIDs: make([]uint32, r.uint32())}
+		// Options
+		r.byte()
+		for i := range truncate.relationIDs {
+			truncate.relationIDs[i] = r.uint32()
+		}
+		msg = truncate
+	default:
+		return nil, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return msg, nil
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/preendata/sqlparser"
+)
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		lsn         string
+		expected    uint64
+		expectError bool
+	}{
+		{"0/0", 0, false},
+		{"16/B374D848", 0x16B374D848, false},
+		{"16B374D848", 0, true},
+		{"16/XYZ", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lsn, func(t *testing.T) {
+			result, err := parseLSN(tt.lsn)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("parseLSN() = %x; want %x", result, tt.expected)
+			}
+		})
+	}
+}
+
+// pgoutputMessage builds a pgoutput message from bytes, strings (null terminated), uint16 and uint32 values.
+func pgoutputMessage(parts ...any) []byte {
+	msg := make([]byte, 0)
+	for _, part := range parts {
+		switch part := part.(type) {
+		case byte:
+			msg = append(msg, part)
+		case string:
+			msg = append(append(msg, part...), 0)
+		case uint16:
+			msg = binary.BigEndian.AppendUint16(msg, part)
+		case uint32:
+			msg = binary.BigEndian.AppendUint32(msg, part)
+		}
+	}
+	return msg
+}
+
+// pgoutputText builds a tuple column with a text value.
+func pgoutputText(value string) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{'t'}, uint32(len(value))), value...)
+}
+
+func pgoutputTupleData(columns ...[]byte) []byte {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(columns)))
+	for _, column := range columns {
+		data = append(data, column...)
+	}
+	return data
+}
+
+func TestParsePgoutputMessage(t *testing.T) {
+	relation := pgoutputMessage(byte('R'), uint32(16384), "public", "customers", byte('d'), uint16(2),
+		byte(1), "id", uint32(23), uint32(0xffffffff),
+		byte(0), "name", uint32(25), uint32(0xffffffff),
+	)
+	insert := append(pgoutputMessage(byte('I'), uint32(16384), byte('N')), pgoutputTupleData(pgoutputText("1"), []byte{'n'})...)
+	update := append(pgoutputMessage(byte('U'), uint32(16384), byte('K')), pgoutputTupleData(pgoutputText("1"), []byte{'n'})...)
+	update = append(append(update, 'N'), pgoutputTupleData(pgoutputText("2"), []byte{'u'})...)
+	del := append(pgoutputMessage(byte('D'), uint32(16384), byte('K')), pgoutputTupleData(pgoutputText("2"), []byte{'n'})...)
+	truncate := pgoutputMessage(byte('T'), uint32(2), byte(0), uint32(16384), uint32(16390))
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expected    any
+		expectError bool
+	}{
+		{"relation", relation, &pgoutputRelation{id: 16384, namespace: "public", name: "customers", replicaIdentity: 'd', columns: []pgoutputColumn{{"id", 23, true}, {"name", 25, false}}}, false},
+		{"insert", insert, &pgoutputInsert{relationID: 16384, tuple: pgoutputTuple{{'t', []byte("1")}, {'n', nil}}}, false},
+		{"update", update, &pgoutputUpdate{
+			relationID: 16384,
+			oldTuple:   pgoutputTuple{{'t', []byte("1")}, {'n', nil}},
+			newTuple:   pgoutputTuple{{'t', []byte("2")}, {'u', nil}},
+		}, false},
+		{"delete", del, &pgoutputDelete{relationID: 16384, oldTuple: pgoutputTuple{{'t', []byte("2")}, {'n', nil}}}, false},
+		{"truncate", truncate, &pgoutputTruncate{relationIDs: []uint32{16384, 16390}}, false},
+		{"begin is skipped", pgoutputMessage(byte('B'), uint32(0), uint32(0)), nil, false},
+		{"truncated message", insert[:len(insert)-1], nil, true},
+		{"empty message", []byte{}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parsePgoutputMessage(tt.data)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parsePgoutputMessage() = %#v; want %#v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPgoutputApplier(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stmt, err := sqlparser.Parse("select id, name as customer_name from customers")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	model := &Model{Name: "customers", Parsed: stmt, CDC: &CDC{PrimaryKey: []string{"id"}}}
+	if err = validateCDC(model); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	source := Source{Name: "crm"}
+	r := &Retriever{Source: source, CDC: newCDCProgress(model, source, "customers", "0/16B3748")}
+
+	// The replicated table has an extra column that the model does not select
+	relation := pgoutputMessage(byte('R'), uint32(16384), "public", "customers", byte('d'), uint16(3),
+		byte(1), "id", uint32(23), uint32(0xffffffff),
+		byte(0), "email", uint32(25), uint32(0xffffffff),
+		byte(0), "name", uint32(25), uint32(0xffffffff),
+	)
+	insert := func(id, name string) []byte {
+		return append(pgoutputMessage(byte('I'), uint32(16384), byte('N')), pgoutputTupleData(pgoutputText(id), []byte{'n'}, pgoutputText(name))...)
+	}
+	// The key changes from 2 to 3
+	update := append(pgoutputMessage(byte('U'), uint32(16384), byte('K')), pgoutputTupleData(pgoutputText("2"), []byte{'n'}, []byte{'n'})...)
+	update = append(append(update, 'N'), pgoutputTupleData(pgoutputText("3"), []byte{'n'}, pgoutputText("Carol"))...)
+	del := append(pgoutputMessage(byte('D'), uint32(16384), byte('K')), pgoutputTupleData(pgoutputText("1"), []byte{'n'}, []byte{'n'})...)
+	otherTable := append(pgoutputMessage(byte('I'), uint32(20000), byte('N')), pgoutputTupleData(pgoutputText("9"))...)
+
+	a := newPgoutputApplier(r)
+	for _, msg := range [][]byte{relation, insert("1", "Alice"), insert("2", "Bob"), update, del, otherTable} {
+		if err = a.apply(msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	ic := make(chan []driver.Value, 10)
+	a.flush(ic)
+	close(ic)
+	upserts := make([][]driver.Value, 0)
+	for row := range ic {
+		upserts = append(upserts, row)
+	}
+
+	expectedUpserts := [][]driver.Value{{"crm", int32(3), "Carol"}}
+	if !reflect.DeepEqual(upserts, expectedUpserts) {
+		t.Errorf("upserts = %v; want %v", upserts, expectedUpserts)
+	}
+	expectedDeletes := [][]driver.Value{{"crm", int32(1), nil}, {"crm", int32(2), nil}}
+	if !reflect.DeepEqual(r.CDC.deletes, expectedDeletes) {
+		t.Errorf("deletes = %v; want %v", r.CDC.deletes, expectedDeletes)
+	}
+
+	truncate := pgoutputMessage(byte('T'), uint32(1), byte(0), uint32(16384))
+	if err = a.apply(truncate); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.CDC.replace || len(a.pending) != 0 {
+		t.Errorf("truncate did not reset the pending changes")
+	}
+}
+
+func TestCheckReplicaIdentity(t *testing.T) {
+	stmt, err := sqlparser.Parse("select id, email as customer_email from customers")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name        string
+		primaryKey  []string
+		identity    byte
+		keyColumns  []string
+		expectError bool
+	}{
+		{"table primary key", []string{"id"}, 'd', []string{"id"}, false},
+		{"aliased column outside the primary key", []string{"customer_email"}, 'd', []string{"id"}, true},
+		{"replica identity full", []string{"customer_email"}, 'f', nil, false},
+		{"replica identity index", []string{"customer_email"}, 'i', []string{"email"}, false},
+		{"replica identity nothing", []string{"id"}, 'n', nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &Model{Name: "customers", Parsed: stmt, CDC: &CDC{PrimaryKey: tt.primaryKey}}
+			if err := validateCDC(model); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err := checkReplicaIdentity(model.CDC, tt.identity, tt.keyColumns)
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
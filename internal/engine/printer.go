@@ -1,11 +1,17 @@
 package engine
 
 import (
+	"bufio"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
 )
 
 // PrettyPrintJSON pretty prints a slice of maps containing JSON objects.
@@ -78,3 +84,208 @@ func WriteToTable(rows []map[string]any, columns []string, outputFormat string)
 
 	return nil
 }
+
+// PrintJSONStream prints the rows of a query stream as a pretty JSON array, writing each row as it is read.
+// The output matches PrintPrettyJSON.
+func PrintJSONStream(qs *QueryStream) error {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	count := 0
+	for qs.Next() {
+		prettyJSON, err := json.MarshalIndent(qs.Row(), "    ", "    ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n    "
+		if count == 0 {
+			separator = "[\n    "
+		}
+		if _, err = w.WriteString(separator); err != nil {
+			return err
+		}
+		if _, err = w.Write(prettyJSON); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := qs.Err(); err != nil {
+		return err
+	}
+
+	closing := "\n]\n"
+	if count == 0 {
+		closing = "[]\n"
+	}
+	_, err := w.WriteString(closing)
+	return err
+}
+
+// tableBatchSize is the number of rows the table format renders at a time.
+const tableBatchSize = 1000
+
+// WriteQueryStream prints the rows of a query stream in the given output format. CSV and markdown rows are
+// written as they are read, tables are rendered in batches of rows.
+func WriteQueryStream(qs *QueryStream, outputFormat string) error {
+	switch outputFormat {
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(qs.Columns); err != nil {
+			return err
+		}
+		record := make([]string, len(qs.Columns))
+		for qs.Next() {
+			for i, value := range qs.Values() {
+				record[i] = formatCell(value)
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return qs.Err()
+	case "markdown":
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		separators := make([]string, len(qs.Columns))
+		for i := range separators {
+			separators[i] = "---"
+		}
+		if err := writeMarkdownRow(w, qs.Columns); err != nil {
+			return err
+		}
+		if err := writeMarkdownRow(w, separators); err != nil {
+			return err
+		}
+		record := make([]string, len(qs.Columns))
+		for qs.Next() {
+			for i, value := range qs.Values() {
+				record[i] = strings.ReplaceAll(formatCell(value), "|", "\\|")
+			}
+			if err := writeMarkdownRow(w, record); err != nil {
+				return err
+			}
+		}
+		return qs.Err()
+	default:
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		return writeTableStream(w, qs.Columns, func() ([]any, error) {
+			if qs.Next() {
+				return qs.Values(), nil
+			}
+			return nil, qs.Err()
+		})
+	}
+}
+
+// writeTableStream renders rows as a table one batch at a time, so only a batch is held in memory. next
+// returns the following row, or nil once the rows are exhausted. Column widths and alignment are fixed by
+// the header and the first batch, later values wider than their column are wrapped.
+func writeTableStream(w io.Writer, columns []string, next func() ([]any, error)) error {
+	header := table.Row{}
+	for _, column := range columns {
+		header = append(header, column)
+	}
+	var columnConfigs []table.ColumnConfig
+	var bottomBorder string
+	for batch := 0; ; batch++ {
+		rows := make([]table.Row, 0, tableBatchSize)
+		for len(rows) < tableBatchSize {
+			values, err := next()
+			if err != nil {
+				return err
+			}
+			if values == nil {
+				break
+			}
+			rows = append(rows, append(table.Row{}, values...))
+		}
+		if batch > 0 && len(rows) == 0 {
+			break
+		}
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleLight)
+		if batch == 0 {
+			t.AppendHeader(header)
+			columnConfigs = tableColumnConfigs(header, rows, t.Style().Format.Header)
+		}
+		t.SetColumnConfigs(columnConfigs)
+		t.AppendRows(rows)
+
+		// Batches are joined by dropping their top and bottom borders, the bottom is written after the last batch
+		lines := strings.Split(t.Render(), "\n")
+		if batch > 0 {
+			lines = lines[1:]
+		}
+		bottomBorder = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+		if len(rows) < tableBatchSize {
+			break
+		}
+	}
+	_, err := io.WriteString(w, bottomBorder+"\n")
+	return err
+}
+
+// tableColumnConfigs sizes and aligns every column like go-pretty does for the header and rows, so batches
+// rendered separately line up.
+func tableColumnConfigs(header table.Row, rows []table.Row, headerFormat text.Format) []table.ColumnConfig {
+	configs := make([]table.ColumnConfig, len(header))
+	for i, column := range header {
+		width := text.LongestLineLen(headerFormat.Apply(column.(string)))
+		numeric := true
+		for _, row := range rows {
+			width = max(width, text.LongestLineLen(tableCell(row[i])))
+			numeric = numeric && isNumber(row[i])
+		}
+		configs[i] = table.ColumnConfig{Number: i + 1, WidthMin: width, WidthMax: width, Align: text.AlignLeft}
+		if numeric {
+			configs[i].Align, configs[i].AlignHeader = text.AlignRight, text.AlignRight
+		}
+	}
+	return configs
+}
+
+// tableCell returns a value as go-pretty prints it in a table cell.
+func tableCell(value any) string {
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprint(value)
+	}
+	return strings.ReplaceAll(s, "\t", "    ")
+}
+
+// isNumber reports whether go-pretty right aligns a value.
+func isNumber(value any) bool {
+	if value == nil {
+		return false
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func writeMarkdownRow(w *bufio.Writer, cells []string) error {
+	_, err := w.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	return err
+}
+
+func formatCell(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
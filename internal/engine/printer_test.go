@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// testTableRows returns a row source over rows, like a query stream.
+func testTableRows(rows [][]any) func() ([]any, error) {
+	return func() ([]any, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+}
+
+func TestWriteTableStream(t *testing.T) {
+	rows := make([][]any, 0)
+	for i := 0; i < 2*tableBatchSize+5; i++ {
+		rows = append(rows, []any{int64(i % 10), fmt.Sprintf("tenant-%d", i%10), nil})
+	}
+
+	// Rendered in batches, the table matches the table go-pretty renders at once
+	var output strings.Builder
+	if err := writeTableStream(&output, []string{"id", "name", "deleted_at"}, testTableRows(rows)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := table.NewWriter()
+	expected.SetStyle(table.StyleLight)
+	expected.AppendHeader(table.Row{"id", "name", "deleted_at"})
+	for _, row := range rows {
+		expected.AppendRow(row)
+	}
+	if output.String() != expected.Render()+"\n" {
+		t.Errorf("writeTableStream() rendered a different table than go-pretty")
+	}
+
+	// Values wider than the first batch are wrapped within the column
+	rows[len(rows)-1][1] = "a-tenant-name-wider-than-the-column"
+	output.Reset()
+	if err := writeTableStream(&output, []string{"id", "name", "deleted_at"}, testTableRows(rows)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) != utf8.RuneCountInString(lines[0]) {
+			t.Fatalf("expected lines of equal width, got %q and %q", lines[0], line)
+		}
+	}
+
+	// An empty result prints the header
+	output.Reset()
+	if err := writeTableStream(&output, []string{"id"}, testTableRows(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(output.String(), "\n") != 4 || !strings.Contains(output.String(), "ID") {
+		t.Errorf("writeTableStream() = %q; want the header", output.String())
+	}
+}
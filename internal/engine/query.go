@@ -1,31 +1,121 @@
 package engine
 
+import (
+	"database/sql"
+)
+
 type QueryResults struct {
 	Rows        []map[string]any
 	Columns     []string
-	ResultsChan chan map[string]any
+	ColumnTypes []string
 }
 
-var err error
+// QueryStream reads the results of a statement one row at a time, like database/sql's Rows.
+// Rows are only read from DuckDB when Next is called, so a consumer that writes each row out
+// before reading the next one runs in constant memory. The stream must be closed.
+type QueryStream struct {
+	Columns     []string
+	ColumnTypes []string
+	db          *sql.DB
+	rows        *sql.Rows
+	values      []any
+	err         error
+}
 
-func Execute(statement string) (*QueryResults, error) {
+// StreamQuery runs a statement against the preen DuckDB database and returns a stream over its rows.
+// Args are bound to the statement's $1, $2, ... placeholders.
+func StreamQuery(statement string, args ...any) (*QueryStream, error) {
 	Debug("Executing query: " + statement)
-	qr := QueryResults{
-		ResultsChan: make(chan map[string]any),
+	db, rows, err := ddbQuery(statement, args...)
+	if err != nil {
+		return nil, err
 	}
 
-	go qr.collectResults(qr.ResultsChan)
-
-	qr.Columns, err = ddbQuery(statement, qr.ResultsChan)
+	qs := &QueryStream{db: db, rows: rows}
+	if qs.Columns, err = rows.Columns(); err != nil {
+		qs.Close()
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
+		qs.Close()
 		return nil, err
 	}
+	qs.ColumnTypes = make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		qs.ColumnTypes[i] = columnType.DatabaseTypeName()
+	}
+	qs.values = make([]any, len(qs.Columns))
 
-	return &qr, nil
+	return qs, nil
 }
 
-func (qr *QueryResults) collectResults(c chan map[string]any) {
-	for row := range c {
-		qr.Rows = append(qr.Rows, row)
+// Next reads the next row, returning false when the rows are exhausted or reading failed.
+// Check Err after Next returns false.
+func (qs *QueryStream) Next() bool {
+	if qs.err != nil || !qs.rows.Next() {
+		return false
+	}
+	scanArgs := make([]any, len(qs.values))
+	for i := range qs.values {
+		scanArgs[i] = &qs.values[i]
+	}
+	if qs.err = qs.rows.Scan(scanArgs...); qs.err != nil {
+		return false
 	}
+	return true
+}
+
+// Values returns the current row's values in column order. The slice is reused by the next call to Next.
+func (qs *QueryStream) Values() []any {
+	return qs.values
+}
+
+// Row returns the current row as a map of column name to value.
+func (qs *QueryStream) Row() map[string]any {
+	row := make(map[string]any, len(qs.Columns))
+	for i, column := range qs.Columns {
+		row[column] = qs.values[i]
+	}
+	return row
+}
+
+// Err returns the error, if any, that stopped the stream.
+func (qs *QueryStream) Err() error {
+	if qs.err != nil {
+		return qs.err
+	}
+	return qs.rows.Err()
+}
+
+// Close releases the rows and the DuckDB connection. It is safe to call more than once.
+func (qs *QueryStream) Close() error {
+	if qs.rows != nil {
+		qs.rows.Close()
+	}
+	return qs.db.Close()
+}
+
+// Execute runs a statement against the preen DuckDB database and reads all of its rows into memory.
+// Args are bound to the statement's $1, $2, ... placeholders. Use StreamQuery for large results.
+func Execute(statement string, args ...any) (*QueryResults, error) {
+	qs, err := StreamQuery(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer qs.Close()
+
+	qr := QueryResults{
+		Rows:        make([]map[string]any, 0),
+		Columns:     qs.Columns,
+		ColumnTypes: qs.ColumnTypes,
+	}
+	for qs.Next() {
+		qr.Rows = append(qr.Rows, qs.Row())
+	}
+	if err = qs.Err(); err != nil {
+		return nil, err
+	}
+
+	return &qr, nil
 }
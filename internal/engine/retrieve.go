@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"database/sql/driver"
 	"fmt"
 	"slices"
@@ -10,126 +11,170 @@ import (
 )
 
 type Retriever struct {
-	ModelName    string
-	TableName    string
-	Query        string
-	Source       Source
-	Options      Options
-	Format       string
-	FilePatterns *[]string
-	Collection   string
+	ModelName string
+	TableName string
+	Query     string
+	Source    Source
+	Options   Options
+	// ParquetOptions and JSONOptions are the options of parquet and json file models
+	ParquetOptions ParquetOptions
+	JSONOptions    JSONOptions
+	Format         string
+	FilePatterns   *[]string
+	Collection     string
+	Pipeline       string
+	Projection     string
+	Fields         []DocumentField
+	// CDC is set for CDC models, the postgres and mysql engines then read the changes since the stored position
+	CDC *cdcProgress
 }
 
 // Retrieve data from sources and insert into the duckDB database.
+// Each source is streamed by its registered SourceEngine.
 // Database sources are inserted via the Insert function.
 // File sources are inserted via the native duckDB integrations.
+// A summary of every source's result is printed and stored once retrieval ends.
 func Retrieve(sc *SourceConfig, mc *ModelConfig) error {
+	br := newBuildResults()
+	defer br.report()
+
 	for _, model := range mc.Models {
-		ic := make(chan []driver.Value, 10000)
-		dc := make(chan []int64)
-		tableName := strings.ReplaceAll(string(model.Name), "-", "_")
-		// Only insert database models into DuckDB
-		if model.Type == "database" {
-			go Insert(ModelName(tableName), ic, dc)
+		// Transform models are built from the retrieved models afterwards
+		if model.Type == "transform" {
+			continue
+		}
+		if err := retrieveModel(sc, model, br); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retrieveModel fans out the retrieval of a model to all of its sources.
+// Failed sources are handled according to the model's failure policy.
+func retrieveModel(sc *SourceConfig, model *Model, br *BuildResults) error {
+	ic := make(chan []driver.Value, 10000)
+	dc := make(chan insertResult)
+	tableName := strings.ReplaceAll(string(model.Name), "-", "_")
+	// Incremental and CDC models are inserted into a staging table and merged afterwards
+	insertTableName := tableName
+	cursors := make(map[string]incrementalCursor)
+	cdcProgresses := make(map[string]*cdcProgress)
+	if model.Incremental != nil || model.CDC != nil {
+		insertTableName = stagingTableName(tableName)
+		var err error
+		if cursors, err = getIncrementalCursors(model); err != nil {
+			return err
 		}
-		g := errgroup.Group{}
-		g.SetLimit(200)
+	}
+	if model.CDC != nil {
 		for _, source := range sc.Sources {
-			if !slices.Contains(source.Models, string(model.Name)) {
-				Debug(fmt.Sprintf("Skipping %s for %s", model.Name, source.Name))
-				continue
+			if slices.Contains(source.Models, string(model.Name)) && source.Engine != "postgres" && source.Engine != "mysql" {
+				return fmt.Errorf("cdc model %s is only supported for postgres and mysql sources, %s uses %s", model.Name, source.Name, source.Engine)
 			}
-			r := Retriever{
-				Source:       source,
-				ModelName:    string(model.Name),
-				Query:        model.Query,
-				Options:      model.Options,
-				Format:       model.Format,
-				FilePatterns: model.FilePatterns,
-				TableName:    tableName,
+		}
+	}
+	// Only insert database models into DuckDB
+	if model.Type == "database" {
+		go Insert(ModelName(insertTableName), ic, dc)
+	}
+	// Once the failure policy is broken the group's context is cancelled, and sources that have not
+	// started yet are skipped
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(200)
+	for _, source := range sc.Sources {
+		if !slices.Contains(source.Models, string(model.Name)) {
+			Debug(fmt.Sprintf("Skipping %s for %s", model.Name, source.Name))
+			continue
+		}
+		r := Retriever{
+			Source:         source,
+			ModelName:      string(model.Name),
+			Query:          model.Query,
+			Options:        model.Options,
+			ParquetOptions: model.ParquetOptions,
+			JSONOptions:    model.JSONOptions,
+			Format:         model.Format,
+			FilePatterns:   model.FilePatterns,
+			TableName:      tableName,
+			Pipeline:       model.Pipeline,
+			Projection:     model.Projection,
+			Fields:         model.Fields,
+		}
+		if model.Incremental != nil {
+			r.Query = incrementalQuery(model, cursors[source.Name])
+		}
+		if model.CDC != nil {
+			r.CDC = newCDCProgress(model, source, tableName, cursors[source.Name].value)
+			cdcProgresses[source.Name] = r.CDC
+		}
+		if model.Collection != "" {
+			r.Collection = model.Collection
+		} else {
+			r.Collection = string(model.Name)
+		}
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				Debug(fmt.Sprintf("Skipping %s for %s, the build has failed", model.Name, source.Name))
+				return nil
 			}
-			if model.Collection != "" {
-				r.Collection = model.Collection
-			} else {
-				r.Collection = string(model.Name)
+			result := retrieveFromSource(&r, ic)
+			br.add(result)
+			if result.Err != nil {
+				Error(fmt.Sprintf("Error retrieving %s from %s: %s", result.ModelName, result.SourceName, result.Err))
+				return model.FailurePolicy.failureError(model.Name, br.failures(string(model.Name)))
 			}
-			switch source.Engine {
-			case "s3":
-				err := func(r Retriever, ic chan []driver.Value) error {
-					g.Go(func() error {
-						if err := ingestS3Model(&r); err != nil {
-							return err
-						}
-						return nil
-					})
+			return nil
+		})
+	}
+	err := g.Wait()
+	ic <- []driver.Value{"quit"}
+	if model.Type == "database" {
+		ConfirmInsert(string(model.Name), dc, 0)
+	}
+	if err != nil {
+		return err
+	}
 
-					return nil
-				}(r, ic)
-				if err != nil {
-					return err
-				}
-			case "snowflake":
-				err := func(r Retriever, ic chan []driver.Value) error {
-					g.Go(func() error {
-						if err := ingestSnowflakeModel(&r, ic); err != nil {
-							return err
-						}
-						return nil
-					})
-					return nil
-				}(r, ic)
-				if err != nil {
-					return err
-				}
-			case "postgres":
-				err := func(r Retriever, ic chan []driver.Value) error {
-					g.Go(func() error {
-						if err := ingestPostgresModel(&r, ic); err != nil {
-							return err
-						}
-						return nil
-					})
-					return nil
-				}(r, ic)
-				if err != nil {
-					return err
-				}
-			case "mysql":
-				err := func(r Retriever, ic chan []driver.Value) error {
-					g.Go(func() error {
-						if err := ingestMysqlModel(&r, ic); err != nil {
-							return err
-						}
-						return nil
-					})
-					return nil
-				}(r, ic)
-				if err != nil {
-					return err
-				}
-			case "mongodb":
-				err := func(r Retriever, ic chan []driver.Value) error {
-					g.Go(func() error {
-						if err := ingestMongoModel(&r, ic); err != nil {
-							return err
-						}
-						return nil
-					})
-					return nil
-				}(r, ic)
-				if err != nil {
-					return err
-				}
-			default:
-				Error(fmt.Sprintf("Engine %s not supported", source.Engine))
+	failures := br.failures(string(model.Name))
+	if len(failures) > 0 {
+		if model.Type == "database" {
+			if err := removePartialSourceRows(insertTableName, failures); err != nil {
+				return err
 			}
 		}
-		if err := g.Wait(); err != nil {
+		Warn(fmt.Sprintf("%d sources failed for model %s. Continuing with the remaining sources", len(failures), model.Name))
+	}
+
+	if model.Incremental != nil {
+		if err := mergeIncrementalModel(model, tableName); err != nil {
 			return err
 		}
-		ic <- []driver.Value{"quit"}
-		if model.Type == "database" {
-			ConfirmInsert(string(model.Name), dc, 0)
+	}
+	if model.CDC != nil {
+		// Failed sources keep their stored position, their changes are read again by the next build
+		for _, failure := range failures {
+			delete(cdcProgresses, failure.SourceName)
+		}
+		if err := mergeCDCModel(model, tableName, cdcProgresses); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removePartialSourceRows deletes the rows that failed sources inserted before their error,
+// so the model table only contains complete data from the sources that succeeded. Rows are
+// retrieved and inserted concurrently, so the delete runs whatever the source retrieved.
+func removePartialSourceRows(tableName string, failures []SourceResult) error {
+	for _, failure := range failures {
+		Debug(fmt.Sprintf("Removing partial rows for failed source %s", failure.SourceName))
+		query := fmt.Sprintf(
+			"delete from main.%s where preen_source_name = '%s'", tableName, strings.ReplaceAll(failure.SourceName, "'", "''"),
+		)
+		if err := ddbExec(query); err != nil {
+			return fmt.Errorf("error removing partial rows for source %s: %w", failure.SourceName, err)
 		}
 	}
 	return nil
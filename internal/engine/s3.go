@@ -1,132 +1,176 @@
 package engine
 
 import (
+	"context"
+	"database/sql/driver"
 	"fmt"
-	"path/filepath"
-	"reflect"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-func ingestS3Model(r *Retriever) error {
-	switch r.Format {
-	case "csv":
-		optionsString, err := getCSVOptions(r.Options)
-		if err != nil {
-			return fmt.Errorf("failed to get csv options: %v", err)
-		}
-		query := fmt.Sprintf(
-			`create or replace table main.%s as select * from read_csv(%s,%s)
-			`, r.TableName, formatFilePatterns(r), *optionsString,
-		)
-		Debug(fmt.Sprintf("running query: %s", query))
-		if err := ddbExec(query); err != nil {
-			Debug(fmt.Sprintf("running query: %s", query))
-			return fmt.Errorf("failed to create file model table %s: %v", r.ModelName, err)
-		}
-	default:
-		return fmt.Errorf("unsupported model file format %s", r.Format)
+// s3Engine loads file models through the native duckDB S3 integration.
+// Rows are never sent to the insert channel, duckDB creates the model table directly.
+type s3Engine struct {
+	source Source
+	// secretQuery creates the source's duckDB secret, run with every query reading the source's files
+	secretQuery string
+}
+
+func init() {
+	RegisterSourceEngine("s3", newS3Engine)
+}
+
+func newS3Engine(source Source) SourceEngine {
+	return &s3Engine{source: source}
+}
+
+func (e *s3Engine) Connect() error {
+	ctx := context.Background()
+	cfg, err := s3Config(ctx, e.source)
+	if err != nil {
+		return fmt.Errorf("error loading s3 credentials: %w", err)
+	}
+	if e.secretQuery, err = buildS3Secret(ctx, e.source, cfg); err != nil {
+		return fmt.Errorf("error configuring s3 access: %w", err)
+	}
+	if err := confirmS3Connection(ctx, e.source, cfg); err != nil {
+		return fmt.Errorf("error confirming s3 objects: %w", err)
 	}
 	return nil
 }
 
-func formatFilePatterns(r *Retriever) string {
-	queryString := "["
-	for i, v := range *r.FilePatterns {
-		if i == len(*r.FilePatterns)-1 {
-			queryString += fmt.Sprintf("'%s://%s'", r.Source.Engine, filepath.Join(r.Source.Connection.BucketName, v)) + "]"
-			break
-		}
-		queryString += fmt.Sprintf("'%s://%s', ", r.Source.Engine, filepath.Join(r.Source.Connection.BucketName, v))
+// DescribeColumns is a no-op, duckDB infers the column types of file models.
+func (e *s3Engine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	return nil
+}
+
+func (e *s3Engine) Stream(r *Retriever, ic chan []driver.Value) error {
+	return ingestFileSource(r, e.secretQuery)
+}
+
+func (e *s3Engine) Close() error {
+	return nil
+}
+
+// s3Config loads the AWS config of an S3 source. Static keys replace the credential chain,
+// a profile selects a shared config profile and a role is assumed on top of either.
+func s3Config(ctx context.Context, s Source) (aws.Config, error) {
+	loadOptions := []func(*config.LoadOptions) error{config.WithRegion(s.Connection.Region)}
+	if s.Connection.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(s.Connection.Profile))
 	}
-	return queryString
+	if s.Connection.AccessKeyID != "" {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			s.Connection.AccessKeyID, s.Connection.SecretAccessKey, s.Connection.SessionToken,
+		)))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading default config: %w", err)
+	}
+	if s.Connection.RoleArn != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), s.Connection.RoleArn))
+	}
+	return cfg, nil
 }
 
-func getCSVOptions(o Options) (*string, error) {
-	options := reflect.VisibleFields(reflect.TypeOf(o))
-	queryString := new(string)
-	for _, option := range options {
-		if _, ok := option.Tag.Lookup("default"); !ok {
-			return nil, fmt.Errorf("missing default value for option %s", option.Name)
-		}
-		if _, ok := option.Tag.Lookup("yaml"); !ok {
-			return nil, fmt.Errorf("missing yaml tag for option %s", option.Name)
+// buildS3Secret returns the statement creating a duckDB secret for the source, scoped to its bucket so that
+// every s3 source can use its own credentials. https://duckdb.org/docs/extensions/httpfs/s3api.html
+// Sources without static keys, a profile or a role use duckDB's credential chain. Otherwise the
+// credentials are resolved by the AWS SDK and handed to duckDB as keys.
+func buildS3Secret(ctx context.Context, s Source, cfg aws.Config) (string, error) {
+	var creds *aws.Credentials
+	if s.Connection.AccessKeyID != "" || s.Connection.Profile != "" || s.Connection.RoleArn != "" {
+		retrieved, err := cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error retrieving credentials: %w", err)
 		}
+		creds = &retrieved
+	}
+	return s3SecretQuery(s, creds)
+}
 
-		defaultVal := option.Tag.Get("default")
-		optionName := option.Tag.Get("yaml")
-		optionValue := getDefaultValue(reflect.ValueOf(o).FieldByName(option.Name).Interface(), defaultVal)
-		if optionValue == "" {
-			continue
-		}
-		optionString := fmt.Sprintf("%s = %v", optionName, optionValue)
-		if *queryString == "" {
-			*queryString += optionString
-		} else {
-			*queryString = fmt.Sprintf("%s, %s", *queryString, optionString)
+// s3SecretQuery returns the statement that creates the source's secret. Secrets are temporary, so static
+// keys are never written to disk by duckDB. Temporary secrets only live as long as the duckDB instance,
+// and ddbExec opens a new instance per call, so the secret is created by the same ddbExec that reads the files.
+func s3SecretQuery(s Source, creds *aws.Credentials) (string, error) {
+	quote := func(value string) string {
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(value, "'", "''"))
+	}
+	secretOptions := []string{"type S3"}
+	if creds != nil {
+		secretOptions = append(secretOptions, "provider CONFIG", "key_id "+quote(creds.AccessKeyID), "secret "+quote(creds.SecretAccessKey))
+		if creds.SessionToken != "" {
+			secretOptions = append(secretOptions, "session_token "+quote(creds.SessionToken))
+		}
+	} else {
+		secretOptions = append(secretOptions, "provider CREDENTIAL_CHAIN")
+	}
+	if s.Connection.Region != "" {
+		secretOptions = append(secretOptions, "region "+quote(s.Connection.Region))
+	}
+	if s.Connection.Endpoint != "" {
+		endpoint, err := url.Parse(s3EndpointURL(s.Connection.Endpoint))
+		if err != nil {
+			return "", fmt.Errorf("error parsing s3 endpoint %s: %w", s.Connection.Endpoint, err)
 		}
+		secretOptions = append(secretOptions, "endpoint "+quote(endpoint.Host), fmt.Sprintf("use_ssl %t", endpoint.Scheme == "https"))
+	}
+	if s.Connection.PathStyle {
+		secretOptions = append(secretOptions, "url_style 'path'")
 	}
-	return queryString, nil
+	secretOptions = append(secretOptions, "scope "+quote(fmt.Sprintf("s3://%s", s.Connection.BucketName)))
+
+	return fmt.Sprintf("create or replace secret %s (%s);", s3SecretName(s), strings.Join(secretOptions, ", ")), nil
 }
 
-func getDefaultValue(key any, defaultVal any) any {
-	switch key := key.(type) {
-	case *[]string:
-		// If the key is not set and there is not default value, return an empty string
-		if key == nil && defaultVal == "-" {
-			return ""
-		}
-		// If the key is not set and there is a default value, return the default value
-		if key == nil && defaultVal != "-" {
-			return defaultVal
-		}
-		// Convert the []string from YAML to a string array for the query
-		queryString := "["
-		for i, v := range *key {
-			if i == len(*key)-1 {
-				queryString += v + "]"
-				break
-			}
-			queryString += v + ", "
-		}
-		return queryString
-	case *bool:
-		if key == nil {
-			return defaultVal
-		}
-		return *key
-	case *string:
-		// If the key is not set and there is not default value, return an empty string
-		if key == nil && defaultVal == "-" {
-			return ""
-		}
-		// If the key is not set and there is a default value, return the default value
-		if key == nil && defaultVal != "-" {
-			return fmt.Sprintf("'%s'", defaultVal)
-		}
-		return fmt.Sprintf("'%s'", *key)
-	case *int64:
-		if key == nil {
-			return defaultVal
-		}
-		return *key
-	case *[]Type:
-		// If the key is not set and there is not default value, return an empty string
-		if key == nil && defaultVal == "-" {
-			return ""
-		}
-		// If the key is not set and there is a default value, return the default value
-		if key == nil && defaultVal != "-" {
-			return defaultVal
-		}
-		// Convert the []Type from YAML to a string object for the query
-		queryString := "{"
-		for i, v := range *key {
-			if i == len(*key)-1 {
-				queryString += fmt.Sprintf("'%s': '%s'", v.Name, v.Type) + "}"
-				break
-			}
-			queryString += fmt.Sprintf("'%s': '%s',", v.Name, v.Type)
-		}
-		return queryString
+// s3SecretName returns the duckDB secret name of a source, e.g. preen_s3_users_us_east_1.
+func s3SecretName(s Source) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(s.Name))
+	return "preen_s3_" + name
+}
+
+// s3EndpointURL defaults endpoints without a scheme, e.g. localhost:9000, to https.
+func s3EndpointURL(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
 	}
-	return key
+	return "https://" + endpoint
+}
+
+// confirmS3Connection confirms that the S3 connection is working,
+// and that at least one object is present inside the bucket.
+func confirmS3Connection(ctx context.Context, s Source, cfg aws.Config) error {
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s.Connection.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s3EndpointURL(s.Connection.Endpoint))
+		}
+		o.UsePathStyle = s.Connection.PathStyle
+	})
+	input := &s3.ListObjectsV2Input{
+		Bucket: &s.Connection.BucketName,
+	}
+
+	result, err := s3Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return fmt.Errorf("unable to list items in bucket %q: %w", s.Connection.BucketName, err)
+	}
+	if len(result.Contents) == 0 {
+		return fmt.Errorf("no objects found in bucket %q", s.Connection.BucketName)
+	} else {
+		Debug(fmt.Sprintf("Found %d objects in bucket %q", len(result.Contents), s.Connection.BucketName))
+	}
+	return nil
 }
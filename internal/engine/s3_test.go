@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestS3SecretQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   Source
+		creds    *aws.Credentials
+		expected string
+	}{
+		{
+			"credential chain",
+			Source{Name: "users-s3-us-east-1", Connection: Connection{BucketName: "users", Region: "us-east-1"}},
+			nil,
+			"create or replace secret preen_s3_users_s3_us_east_1 (type S3, provider CREDENTIAL_CHAIN, region 'us-east-1', scope 's3://users');",
+		},
+		{
+			"static keys",
+			Source{Name: "archive", Connection: Connection{BucketName: "archive", Region: "eu-west-1"}},
+			&aws.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "it's secret", SessionToken: "token"},
+			"create or replace secret preen_s3_archive (type S3, provider CONFIG, key_id 'AKIA', secret 'it''s secret', session_token 'token', region 'eu-west-1', scope 's3://archive');",
+		},
+		{
+			"minio",
+			Source{Name: "MinIO", Connection: Connection{BucketName: "fixtures", Region: "us-east-1", Endpoint: "http://localhost:9000", PathStyle: true}},
+			&aws.Credentials{AccessKeyID: "minio", SecretAccessKey: "minio123"},
+			"create or replace secret preen_s3_minio (type S3, provider CONFIG, key_id 'minio', secret 'minio123', region 'us-east-1', endpoint 'localhost:9000', use_ssl false, url_style 'path', scope 's3://fixtures');",
+		},
+		{
+			"endpoint without scheme",
+			Source{Name: "r2", Connection: Connection{BucketName: "exports", Endpoint: "account.r2.cloudflarestorage.com"}},
+			nil,
+			"create or replace secret preen_s3_r2 (type S3, provider CREDENTIAL_CHAIN, endpoint 'account.r2.cloudflarestorage.com', use_ssl true, scope 's3://exports');",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s3SecretQuery(tt.source, tt.creds)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("s3SecretQuery() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestS3SecretIngest checks that the secret created for a source is visible to the query reading its files,
+// by ingesting duckdb_secrets() in place of the source's files. The secret's keys must not be logged.
+func TestS3SecretIngest(t *testing.T) {
+	if err := Initialize("DEBUG"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var logs bytes.Buffer
+	logger.Out = &logs
+	defer func() { logger.Out = os.Stdout }()
+	// ddbExec opens ./preenContext.db
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Chdir(wd)
+	if err = ddbExec("select 1"); err != nil {
+		t.Skipf("duckdb aws and httpfs extensions unavailable: %v", err)
+	}
+
+	source := Source{Name: "archive", Engine: "s3", Connection: Connection{BucketName: "archive", Region: "eu-west-1"}}
+	secretQuery, err := s3SecretQuery(source, &aws.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "s3cr3t-key"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := &Retriever{ModelName: "secrets", TableName: "secrets", Source: source}
+	if err = ingestFileModel(r, "duckdb_secrets()", secretQuery); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(logs.String(), "s3cr3t-key") {
+		t.Errorf("secret access key was logged: %s", logs.String())
+	}
+
+	db, rows, err := ddbQuery("select name from main.secrets")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer db.Close()
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != "preen_s3_archive" {
+		t.Errorf("ingest query saw secrets %v; want [preen_s3_archive]", names)
+	}
+}
@@ -2,60 +2,215 @@ package engine
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/pem"
 	"fmt"
+	"os"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/snowflakedb/gosnowflake"
+	"github.com/youmark/pkcs8"
 )
 
 func getSnowflakePoolFromSource(source Source) (*sql.DB, error) {
+	config, err := snowflakeConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	connStr, err := gosnowflake.DSN(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Snowflake connection for source %s: %w", source.Name, err)
+	}
+
+	db, err := sql.Open("snowflake", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("error opening Snowflake connection: %w", err)
+	}
+	err = db.PingContext(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error pinging Snowflake: %w", err)
+	}
+
+	return db, nil
+}
 
-	config := gosnowflake.Config{
+// snowflakeConfig builds the driver config of a source, or parses it from the source's uri. Sources authenticate
+// with an OAuth token when token is set, with an RSA key pair when private_key_path is set, and with their password otherwise.
+func snowflakeConfig(source Source) (*gosnowflake.Config, error) {
+	if source.Connection.URI != "" {
+		config, err := gosnowflake.ParseDSN(source.Connection.URI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Snowflake uri for source %s: %w", source.Name, err)
+		}
+		return config, nil
+	}
+	config := &gosnowflake.Config{
 		Account:   source.Connection.Account,
 		User:      source.Connection.Username,
-		Password:  source.Connection.Password,
 		Database:  source.Connection.Database,
 		Schema:    source.Connection.Schema,
 		Warehouse: source.Connection.Warehouse,
+		Role:      source.Connection.Role,
+	}
+	switch {
+	case source.Connection.Token != "":
+		config.Authenticator = gosnowflake.AuthTypeOAuth
+		config.Token = source.Connection.Token
+	case source.Connection.PrivateKeyPath != "":
+		privateKey, err := readSnowflakePrivateKey(source.Connection.PrivateKeyPath, source.Connection.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		config.Authenticator = gosnowflake.AuthTypeJwt
+		config.PrivateKey = privateKey
+	default:
+		config.Password = source.Connection.Password
 	}
-	connStr, err := gosnowflake.DSN(&config)
+	// Options are session parameters, e.g. query_tag
+	if len(source.Connection.Options) > 0 {
+		config.Params = make(map[string]*string, len(source.Connection.Options))
+		for key, value := range source.Connection.Options {
+			config.Params[key] = &value
+		}
+	}
+	return config, nil
+}
 
+// readSnowflakePrivateKey reads a PEM encoded RSA private key, in PKCS#8 form, encrypted or not, or in PKCS#1 form.
+func readSnowflakePrivateKey(path string, passphrase string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("error reading Snowflake private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found in %s", path)
 	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Snowflake private key %s: %w", path, err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		if block.Type == "ENCRYPTED PRIVATE KEY" && passphrase == "" {
+			return nil, fmt.Errorf("private_key_passphrase required for encrypted private key %s", path)
+		}
+		privateKey, err := pkcs8.ParsePKCS8PrivateKeyRSA(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Snowflake private key %s: %w", path, err)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %s in %s", block.Type, path)
+	}
+}
 
-	db, err := sql.Open("snowflake", connStr)
+type snowflakeEngine struct {
+	source Source
+	pool   *sql.DB
+}
+
+func init() {
+	RegisterSourceEngine("snowflake", newSnowflakeEngine)
+}
+
+func newSnowflakeEngine(source Source) SourceEngine {
+	return &snowflakeEngine{source: source}
+}
+
+func (e *snowflakeEngine) Connect() error {
+	pool, err := getSnowflakePoolFromSource(e.source)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	err = db.PingContext(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("error pinging Snowflake: %w", err)
+	e.pool = pool
+	return nil
+}
+
+// DescribeColumns queries the snowflake information schema for the tables used by a SQL model. Unqualified
+// tables are looked up in the source's schema, PUBLIC unless set. Unquoted Snowflake identifiers are upper
+// case, so tables are matched case insensitively and reported under the table name used by the query.
+func (e *snowflakeEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	if model.Type != "database" || model.Parsed == nil || len(model.TableSet) == 0 {
+		return nil
+	}
+	defaultSchema := e.source.Connection.Schema
+	if defaultSchema == "" {
+		defaultSchema = "PUBLIC"
 	}
 
-	return db, nil
-}
+	tableNames := make(map[string][]TableName)
+	conditions := make([]string, 0, len(model.TableSet))
+	args := make([]any, 0, 2*len(model.TableSet))
+	for _, tableName := range model.TableSet {
+		schema, table := splitTableName(tableName)
+		if schema == "" {
+			schema = defaultSchema
+		}
+		key := strings.ToUpper(schema + "." + table)
+		if _, ok := tableNames[key]; !ok {
+			conditions = append(conditions, "(table_schema = upper(?) and table_name = upper(?))")
+			args = append(args, schema, table)
+		}
+		tableNames[key] = append(tableNames[key], tableName)
+	}
 
-func ingestSnowflakeModel(r *Retriever, ic chan []driver.Value) error {
-	Debug(fmt.Sprintf("Retrieving context %s for %s", r.ModelName, r.Source.Name))
-	clientPool, err := getSnowflakePoolFromSource(r.Source)
+	query := fmt.Sprintf(`
+		select table_schema, table_name, column_name, data_type from %s.information_schema.columns
+			where %s;
+	`, e.source.Connection.Database, strings.Join(conditions, " or "))
+	rows, err := e.pool.Query(query, args...)
 	if err != nil {
 		return err
 	}
-	defer clientPool.Close()
-	rows, err := clientPool.Query(r.Query)
+	defer rows.Close()
+
+	for rows.Next() {
+		var table_schema string
+		var table_name string
+		var column_name string
+		var data_type string
+		if err = rows.Scan(&table_schema, &table_name, &column_name, &data_type); err != nil {
+			return err
+		}
+		for _, tableName := range tableNames[strings.ToUpper(table_schema+"."+table_name)] {
+			ic <- []driver.Value{e.source.Name, string(model.Name), string(tableName), column_name, data_type}
+		}
+	}
+	return rows.Err()
+}
+
+func (e *snowflakeEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	rows, err := e.pool.Query(r.Query)
 	if err != nil {
 		return fmt.Errorf("error querying Snowflake: %w", err)
 	}
 	defer rows.Close()
 
-	if err = processSnowflakeRows(r, ic, rows); err != nil {
-		return err
+	return processSnowflakeRows(r, ic, rows)
+}
+
+func (e *snowflakeEngine) Query(query string) ([]map[string]any, error) {
+	rows, err := e.pool.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying Snowflake: %w", err)
 	}
 
+	return collectRows(rows)
+}
+
+func (e *snowflakeEngine) Close() error {
+	if e.pool != nil {
+		return e.pool.Close()
+	}
 	return nil
 }
 
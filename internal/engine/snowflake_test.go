@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/youmark/pkcs8"
+)
+
+func writePrivateKey(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func TestSnowflakeConfig(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encrypted, err := pkcs8.MarshalPrivateKey(privateKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	pkcs1Path := writePrivateKey(t, dir, "rsa_key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(privateKey))
+	encryptedPath := writePrivateKey(t, dir, "rsa_key.p8", "ENCRYPTED PRIVATE KEY", encrypted)
+
+	connection := Connection{Account: "acme-analytics", Username: "preen", Database: "events", Schema: "raw", Warehouse: "compute_wh", Role: "reporter"}
+	tests := []struct {
+		name          string
+		connection    func(c Connection) Connection
+		authenticator gosnowflake.AuthType
+		expectError   bool
+	}{
+		{"password", func(c Connection) Connection { c.Password = "p@ss"; return c }, gosnowflake.AuthTypeSnowflake, false},
+		{"oauth", func(c Connection) Connection { c.Token = "token"; return c }, gosnowflake.AuthTypeOAuth, false},
+		{"pkcs1 key pair", func(c Connection) Connection { c.PrivateKeyPath = pkcs1Path; return c }, gosnowflake.AuthTypeJwt, false},
+		{"encrypted key pair", func(c Connection) Connection {
+			c.PrivateKeyPath, c.PrivateKeyPassphrase = encryptedPath, "secret"
+			return c
+		}, gosnowflake.AuthTypeJwt, false},
+		{"wrong passphrase", func(c Connection) Connection {
+			c.PrivateKeyPath, c.PrivateKeyPassphrase = encryptedPath, "guess"
+			return c
+		}, 0, true},
+		{"missing passphrase", func(c Connection) Connection { c.PrivateKeyPath = encryptedPath; return c }, 0, true},
+		{"missing key", func(c Connection) Connection { c.PrivateKeyPath = filepath.Join(dir, "missing.p8"); return c }, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := snowflakeConfig(Source{Name: "warehouse", Connection: tt.connection(connection)})
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.Authenticator != tt.authenticator || config.Role != "reporter" || config.Schema != "raw" {
+				t.Errorf("snowflakeConfig() = %+v", config)
+			}
+			if config.Authenticator == gosnowflake.AuthTypeJwt && !config.PrivateKey.Equal(privateKey) {
+				t.Errorf("snowflakeConfig() read a different private key")
+			}
+			if _, err = gosnowflake.DSN(config); err != nil {
+				t.Errorf("unexpected DSN error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetSnowflakePoolFromSourceInvalid(t *testing.T) {
+	// A missing account is reported instead of panicking
+	if _, err := getSnowflakePoolFromSource(Source{Name: "warehouse", Connection: Connection{Username: "preen", Password: "p@ss"}}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
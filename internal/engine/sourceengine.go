@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SourceEngine is implemented by every engine that preen can retrieve model data from.
+// Engines are registered against the `engine:` value used in sources.yaml, so adding a new
+// engine only requires a new implementation and a call to RegisterSourceEngine.
+type SourceEngine interface {
+	// Connect opens the connection to the source.
+	Connect() error
+	// DescribeColumns sends the column metadata of the model's tables to the information schema channel.
+	// Each message has the form {source_name, model_name, table_name, column_name, data_type}.
+	DescribeColumns(model *Model, ic chan<- []driver.Value) error
+	// Stream retrieves the model's data from the source and sends each row to the insert channel.
+	Stream(r *Retriever, ic chan []driver.Value) error
+	// Close releases the connection to the source.
+	Close() error
+}
+
+// SourceQuerier is implemented by engines that can run an ad-hoc query and return named columns,
+// e.g. to read a source template inventory from a control database.
+type SourceQuerier interface {
+	Query(query string) ([]map[string]any, error)
+}
+
+// SourceEngineFactory creates a new, unconnected SourceEngine for a source.
+type SourceEngineFactory func(source Source) SourceEngine
+
+var sourceEngines = make(map[string]SourceEngineFactory)
+
+// RegisterSourceEngine makes a source engine available under the given engine name.
+// It is intended to be called from init functions and panics if the name is registered twice.
+func RegisterSourceEngine(name string, factory SourceEngineFactory) {
+	if _, exists := sourceEngines[name]; exists {
+		panic(fmt.Sprintf("source engine %s registered twice", name))
+	}
+	sourceEngines[name] = factory
+}
+
+// NewSourceEngine returns the registered engine for the source's `engine:` value.
+func NewSourceEngine(source Source) (SourceEngine, error) {
+	factory, ok := sourceEngines[source.Engine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported engine: %s", source.Engine)
+	}
+	return factory(source), nil
+}
+
+// buildSourceMetadata connects to a source and describes the columns of every model that uses it.
+func buildSourceMetadata(source Source, mc *ModelConfig, ic chan<- []driver.Value) error {
+	// Sources without models, e.g. control databases for source templates, are never retrieved from
+	if len(source.Models) == 0 {
+		Debug(fmt.Sprintf("Skipping metadata for %s: no models configured", source.Name))
+		return nil
+	}
+	se, tunnel, err := connectSourceEngine(source)
+	if err != nil {
+		return err
+	}
+	defer closeSourceEngine(source, se, tunnel)
+
+	for _, model := range mc.Models {
+		if !slices.Contains(source.Models, string(model.Name)) {
+			continue
+		}
+		if err = se.DescribeColumns(model, ic); err != nil {
+			return fmt.Errorf("error describing columns for model %s: %w", model.Name, err)
+		}
+	}
+	return nil
+}
+
+// retrieveFromSource connects to the retriever's source and streams the model data into the insert channel.
+// The returned result records the rows sent by the source, how long it took and any error.
+func retrieveFromSource(r *Retriever, ic chan []driver.Value) SourceResult {
+	Debug(fmt.Sprintf("Retrieving context %s for %s", r.ModelName, r.Source.Name))
+	start := time.Now()
+	result := SourceResult{
+		ModelName:  r.ModelName,
+		SourceName: r.Source.Name,
+	}
+	result.RowsRetrieved, result.Err = streamFromSource(r, ic)
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+// streamFromSource streams the source's rows through a counting channel into the insert channel.
+func streamFromSource(r *Retriever, ic chan []driver.Value) (int64, error) {
+	se, tunnel, err := connectSourceEngine(r.Source)
+	if err != nil {
+		return 0, err
+	}
+	defer closeSourceEngine(r.Source, se, tunnel)
+
+	sourceChan := make(chan []driver.Value, 1000)
+	countChan := make(chan int64)
+	go func() {
+		var rowCounter int64
+		for row := range sourceChan {
+			ic <- row
+			rowCounter++
+		}
+		countChan <- rowCounter
+	}()
+
+	err = se.Stream(r, sourceChan)
+	close(sourceChan)
+
+	return <-countChan, err
+}
+
+// querySource runs an ad-hoc query against a source whose engine implements SourceQuerier.
+func querySource(source Source, query string) ([]map[string]any, error) {
+	se, tunnel, err := connectSourceEngine(source)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSourceEngine(source, se, tunnel)
+
+	querier, ok := se.(SourceQuerier)
+	if !ok {
+		return nil, fmt.Errorf("engine %s does not support queries", source.Engine)
+	}
+
+	return querier.Query(query)
+}
+
+// connectSourceEngine creates the source's engine and connects it, through the source's ssh tunnel if it has one.
+// The engine and tunnel must be released with closeSourceEngine.
+func connectSourceEngine(source Source) (SourceEngine, *sshTunnel, error) {
+	tunneled, tunnel, err := openSSHTunnel(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	se, err := NewSourceEngine(tunneled)
+	if err == nil {
+		if err = se.Connect(); err != nil {
+			err = fmt.Errorf("error connecting to source %s: %w", source.Name, err)
+		}
+	}
+	if err != nil {
+		tunnel.release()
+		return nil, nil, err
+	}
+	return se, tunnel, nil
+}
+
+func closeSourceEngine(source Source, se SourceEngine, tunnel *sshTunnel) {
+	if err := se.Close(); err != nil {
+		Errorf("Error closing connection to source %s: %s", source.Name, err)
+	}
+	tunnel.release()
+}
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestNewSourceEngine(t *testing.T) {
+	for _, engineName := range []string{"postgres", "mysql", "snowflake", "mongodb", "s3", "local", "sqlite", "sqlserver", "clickhouse"} {
+		t.Run(engineName, func(t *testing.T) {
+			se, err := NewSourceEngine(Source{Name: "test", Engine: engineName})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if se == nil {
+				t.Errorf("expected source engine for %s, got nil", engineName)
+			}
+		})
+	}
+
+	_, err := NewSourceEngine(Source{Name: "test", Engine: "not-an-engine"})
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestRegisterSourceEngineTwice(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected panic registering postgres twice")
+		}
+	}()
+	RegisterSourceEngine("postgres", newPostgresEngine)
+}
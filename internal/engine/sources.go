@@ -16,10 +16,35 @@ type Connection struct {
 	AuthSource string `yaml:"auth_source"`
 	BucketName string `yaml:"bucket_name"`
 	Region     string `yaml:"region"`
+	// Schema is the default schema of unqualified tables. Postgres sources search it first,
+	// followed by the schemas of SearchPath, e.g. "shared, public"
 	Schema     string `yaml:"schema"`
+	SearchPath string `yaml:"search_path"`
 	Warehouse  string `yaml:"warehouse"`
 	Role       string `yaml:"role"`
 	Account    string `yaml:"account"`
+	// Snowflake sources authenticate with an OAuth Token, or an RSA key pair read from PrivateKeyPath,
+	// instead of their password
+	Token                string `yaml:"token"`
+	PrivateKeyPath       string `yaml:"private_key_path"`
+	PrivateKeyPassphrase string `yaml:"private_key_passphrase"`
+	// S3 sources use the credential chain unless static keys, a profile or a role are set.
+	// Endpoint and PathStyle point them at S3 compatible stores such as MinIO or LocalStack.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	Profile         string `yaml:"profile"`
+	RoleArn         string `yaml:"role_arn"`
+	Endpoint        string `yaml:"endpoint"`
+	PathStyle       bool   `yaml:"path_style"`
+	// Path is the base directory that the file patterns of local sources resolve against,
+	// or the database file, or glob of files, of sqlite sources
+	Path string `yaml:"path"`
+	TLS  *TLS   `yaml:"tls"`
+	// URI is the engine's own connection string, e.g. mongodb+srv://..., used instead of the discrete fields.
+	// Options are driver parameters added to the connection string generated from the discrete fields.
+	URI     string            `yaml:"uri"`
+	Options map[string]string `yaml:"options"`
 }
 
 type Source struct {
@@ -27,11 +52,13 @@ type Source struct {
 	Engine     string     `yaml:"engine"`
 	Connection Connection `yaml:"connection"`
 	Models     []string   `yaml:"models"`
+	SSHTunnel  *SSHTunnel `yaml:"ssh_tunnel"`
 }
 
 type SourceConfig struct {
-	Sources []Source `yaml:"sources"`
-	Env     *Env     `yaml:"-"` // not in yaml
+	Sources         []Source         `yaml:"sources"`
+	SourceTemplates []SourceTemplate `yaml:"source_templates"`
+	Env             *Env             `yaml:"-"` // not in yaml
 }
 
 func GetSourceConfig() (*SourceConfig, error) {
@@ -79,8 +106,31 @@ func GetSourceConfig() (*SourceConfig, error) {
 		return nil, fmt.Errorf("failed to parse source file: %w", err)
 	}
 
+	// Expand source templates before environment variables, so inventory placeholders take precedence
+	if err = expandSourceTemplates(&sc); err != nil {
+		return nil, fmt.Errorf("failed to expand source templates: %w", err)
+	}
+
 	// Override config with environment variables
 	fromEnv(&sc)
 
+	// URIs are read after environment variables, which commonly hold their credentials
+	if err = applySourceURIs(&sc); err != nil {
+		return nil, fmt.Errorf("invalid uri config: %w", err)
+	}
+
+	// Expand sqlite globs after environment variables, so paths can be read from the environment
+	if err = expandSqliteSources(&sc); err != nil {
+		return nil, fmt.Errorf("failed to expand sqlite sources: %w", err)
+	}
+
+	if err = validateSourceTLS(&sc); err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+
+	if err = validateSourceSSHTunnels(&sc); err != nil {
+		return nil, fmt.Errorf("invalid ssh_tunnel config: %w", err)
+	}
+
 	return &sc, nil
 }
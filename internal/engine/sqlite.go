@@ -0,0 +1,313 @@
+package engine
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type sqliteEngine struct {
+	source Source
+	db     *sql.DB
+}
+
+func init() {
+	RegisterSourceEngine("sqlite", newSqliteEngine)
+}
+
+func newSqliteEngine(source Source) SourceEngine {
+	return &sqliteEngine{source: source}
+}
+
+// Connect opens the database file read only, so preen never creates or modifies it.
+func (e *sqliteEngine) Connect() error {
+	path := e.source.Connection.Path
+	if e.source.Connection.URI != "" {
+		path = e.source.Connection.URI
+	}
+	if path == "" {
+		return fmt.Errorf("path required for sqlite source %s", e.source.Name)
+	}
+	dsn, err := sqliteDSN(e.source)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return fmt.Errorf("error opening sqlite database %s: %w", path, err)
+	}
+	e.db = db
+	return nil
+}
+
+// sqliteDSN returns the source's uri, or the file uri of its path, opened read only. Options are
+// added as uri parameters, e.g. immutable or _busy_timeout.
+func sqliteDSN(source Source) (string, error) {
+	if source.Connection.URI != "" {
+		// Parameters of plain paths are dropped by the driver, so mode=ro requires a file: uri
+		if !strings.HasPrefix(source.Connection.URI, "file:") {
+			return "", fmt.Errorf("sqlite uri must start with file:")
+		}
+		path, rawQuery, _ := strings.Cut(source.Connection.URI, "?")
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", fmt.Errorf("invalid sqlite uri: %w", err)
+		}
+		query.Set("mode", "ro")
+		return fmt.Sprintf("%s?%s", path, query.Encode()), nil
+	}
+	if _, err := os.Stat(source.Connection.Path); err != nil {
+		return "", fmt.Errorf("error accessing sqlite database %s: %w", source.Connection.Path, err)
+	}
+	query := connectionOptions(source)
+	query.Set("mode", "ro")
+	return fmt.Sprintf("file:%s?%s", (&url.URL{Path: source.Connection.Path}).EscapedPath(), query.Encode()), nil
+}
+
+// DescribeColumns reads the declared type of every column of the model's tables from pragma table_info,
+// mapped to a duckdbTypeMap type by SQLite's affinity rules.
+func (e *sqliteEngine) DescribeColumns(model *Model, ic chan<- []driver.Value) error {
+	if model.Type != "database" || model.Parsed == nil {
+		return nil
+	}
+	for _, tableName := range model.TableSet {
+		// The schema of a sqlite table is the name of its database, main unless attached
+		schema, table := splitTableName(tableName)
+		if schema == "" {
+			schema = "main"
+		}
+		rows, err := e.db.Query("select name, type from pragma_table_info(?, ?)", table, schema)
+		if err != nil {
+			return fmt.Errorf("error querying sqlite table info: %w", err)
+		}
+		for rows.Next() {
+			var columnName, declaredType string
+			if err = rows.Scan(&columnName, &declaredType); err != nil {
+				rows.Close()
+				return err
+			}
+			ic <- []driver.Value{e.source.Name, string(model.Name), string(tableName), columnName, sqliteColumnType(declaredType)}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *sqliteEngine) Stream(r *Retriever, ic chan []driver.Value) error {
+	rows, err := e.db.Query(r.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return processSqliteRows(r, ic, rows)
+}
+
+func (e *sqliteEngine) Query(query string) ([]map[string]any, error) {
+	rows, err := e.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows)
+}
+
+func (e *sqliteEngine) Close() error {
+	if e.db != nil {
+		return e.db.Close()
+	}
+	return nil
+}
+
+// processSqliteRows converts every value to the type of its declared column, since SQLite columns can hold
+// values of any type. Columns and expressions without a declared type are converted to text, the type
+// DescribeColumns reports for them.
+func processSqliteRows(r *Retriever, ic chan []driver.Value, rows *sql.Rows) error {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	duckdbTypes := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		duckdbTypes[i] = duckdbTypeMap[sqliteColumnType(columnType.DatabaseTypeName())]
+	}
+	values := make([]any, len(columnTypes))
+	valuePtrs := make([]any, len(columnTypes))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var rowCounter int64
+	for rows.Next() {
+		if err = rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		rowCounter++
+		driverRow := make([]driver.Value, len(values)+1)
+		driverRow[0] = r.Source.Name
+		for i, value := range values {
+			if driverRow[i+1], err = sqliteDriverValue(value, duckdbTypes[i]); err != nil {
+				return fmt.Errorf("error converting column %s: %w", columnTypes[i].Name(), err)
+			}
+		}
+		ic <- driverRow
+	}
+	Debug(fmt.Sprintf("Retrieved %d rows for %s - %s\n", rowCounter, r.Source.Name, r.ModelName))
+	return rows.Err()
+}
+
+// sqliteColumnType maps a declared SQLite column type to a duckdbTypeMap type using SQLite's affinity rules,
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity. Date and boolean declarations keep
+// their type, the driver returns them as time.Time and bool values. Columns without a type are read as text.
+func sqliteColumnType(declaredType string) string {
+	columnType := strings.ToLower(strings.TrimSpace(declaredType))
+	if i := strings.Index(columnType, "("); i != -1 {
+		columnType = strings.TrimSpace(columnType[:i])
+	}
+	switch columnType {
+	case "date", "datetime", "timestamp", "boolean":
+		return columnType
+	case "":
+		return "text"
+	}
+	switch {
+	case strings.Contains(columnType, "int"):
+		return "bigint"
+	case strings.Contains(columnType, "char"), strings.Contains(columnType, "clob"), strings.Contains(columnType, "text"):
+		return "text"
+	case strings.Contains(columnType, "blob"):
+		return "blob"
+	case strings.Contains(columnType, "real"), strings.Contains(columnType, "floa"), strings.Contains(columnType, "doub"):
+		return "double"
+	default:
+		return "numeric"
+	}
+}
+
+// sqliteDriverValue converts a value to the go type the DuckDB appender expects for the column's DuckDB type.
+func sqliteDriverValue(value any, duckdbType string) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch duckdbType {
+	case "bigint":
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case "double":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case "varchar":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	case "blob":
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		}
+	case "date", "timestamp":
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			// The driver returns the text of values it could not parse
+			for _, layout := range sqlite3.SQLiteTimestampFormats {
+				if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+					return t, nil
+				}
+			}
+		case int64:
+			return time.Unix(v, 0).UTC(), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, duckdbType)
+}
+
+// expandSqliteSources replaces every sqlite source whose path is a glob with one source per matched file.
+// The sources are named after the matched path below the glob's directory, e.g. the path
+// /data/stores/*/edge.db of source edge matches /data/stores/042/edge.db as source edge-042-edge.
+func expandSqliteSources(sc *SourceConfig) error {
+	sources := make([]Source, 0, len(sc.Sources))
+	for _, source := range sc.Sources {
+		pattern := source.Connection.Path
+		if source.Engine != "sqlite" || !strings.ContainsAny(pattern, "*?[") {
+			sources = append(sources, source)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid path for sqlite source %s: %w", source.Name, err)
+		}
+		if len(matches) == 0 {
+			Warn(fmt.Sprintf("No sqlite databases match %s for source %s", pattern, source.Name))
+			continue
+		}
+		// The directory of the pattern before its first glob character
+		baseDir := filepath.Dir(pattern[:strings.IndexAny(pattern, "*?[")] + "x")
+		Debug(fmt.Sprintf("Expanding sqlite source %s over %d databases", source.Name, len(matches)))
+		for _, match := range matches {
+			rel, err := filepath.Rel(baseDir, match)
+			if err != nil {
+				return err
+			}
+			rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+			expanded := source
+			expanded.Name = fmt.Sprintf("%s-%s", source.Name, strings.ReplaceAll(rel, string(filepath.Separator), "-"))
+			expanded.Connection.Path = match
+			sources = append(sources, expanded)
+		}
+	}
+	sc.Sources = sources
+
+	return errorOnDuplicateSources(sc)
+}
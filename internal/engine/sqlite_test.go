@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/preendata/sqlparser"
+)
+
+func TestSqliteColumnType(t *testing.T) {
+	tests := []struct {
+		declaredType string
+		expected     string
+	}{
+		{"INTEGER", "bigint"},
+		{"UNSIGNED BIG INT", "bigint"},
+		{"VARCHAR(255)", "text"},
+		{"", "text"},
+		{"BLOB", "blob"},
+		{"DOUBLE PRECISION", "double"},
+		{"DECIMAL(10,5)", "numeric"},
+		{"DATETIME", "datetime"},
+		{"boolean", "boolean"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.declaredType, func(t *testing.T) {
+			if result := sqliteColumnType(tt.declaredType); result != tt.expected {
+				t.Errorf("sqliteColumnType() = %s; want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSqliteDriverValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       any
+		duckdbType  string
+		expected    driver.Value
+		expectError bool
+	}{
+		{"integer", int64(42), "bigint", int64(42), false},
+		{"integral real as integer", float64(42), "bigint", int64(42), false},
+		{"text as integer", "42", "bigint", int64(42), false},
+		{"fractional real as integer", 4.2, "bigint", nil, true},
+		{"integer as double", int64(3), "double", float64(3), false},
+		{"integer as text", int64(7), "varchar", "7", false},
+		{"bytes as text", []byte("abc"), "varchar", "abc", false},
+		{"text as blob", "abc", "blob", []byte("abc"), false},
+		{"integer as boolean", int64(1), "boolean", true, false},
+		{"text as timestamp", "2024-03-05 10:20:30", "timestamp", time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC), false},
+		{"invalid timestamp", "yesterday", "timestamp", nil, true},
+		{"null", nil, "bigint", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sqliteDriverValue(tt.value, tt.duckdbType)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("sqliteDriverValue() = %#v; want %#v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandSqliteSources(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	for _, store := range []string{"001", "002"} {
+		if err := os.MkdirAll(filepath.Join(dir, store), 0o755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, store, "edge.db"), nil, 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	sc := &SourceConfig{Sources: []Source{
+		{Name: "edge", Engine: "sqlite", Connection: Connection{Path: filepath.Join(dir, "*", "edge.db")}},
+		{Name: "empty", Engine: "sqlite", Connection: Connection{Path: filepath.Join(dir, "*.sqlite")}},
+		{Name: "single", Engine: "sqlite", Connection: Connection{Path: filepath.Join(dir, "001", "edge.db")}},
+	}}
+	if err := expandSqliteSources(sc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"edge-001-edge": filepath.Join(dir, "001", "edge.db"),
+		"edge-002-edge": filepath.Join(dir, "002", "edge.db"),
+		"single":        filepath.Join(dir, "001", "edge.db"),
+	}
+	result := make(map[string]string)
+	for _, source := range sc.Sources {
+		result[source.Name] = source.Connection.Path
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expandSqliteSources() = %v; want %v", result, expected)
+	}
+}
+
+func TestSqliteEngine(t *testing.T) {
+	if err := Initialize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "shop.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = db.Exec(`create table orders (id integer primary key, total decimal(10,2), note, created datetime);
+		insert into orders values (1, 12.5, 'first', '2024-03-05 10:20:30'), (2, 7, 3, null);`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source := Source{Name: "shop", Engine: "sqlite", Connection: Connection{Path: path}}
+	e := newSqliteEngine(source)
+	if err = e.Connect(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.Close()
+
+	stmt, err := sqlparser.Parse("select id, total, note, created from orders")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	model := &Model{Name: "orders", Type: "database", Parsed: stmt, TableSet: []TableName{"orders"}}
+	ic := make(chan []driver.Value, 10)
+	if err = e.DescribeColumns(model, ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ic) != 4 {
+		t.Fatalf("DescribeColumns() sent %d columns; want 4", len(ic))
+	}
+	for _, dataType := range []string{"bigint", "numeric", "text", "datetime"} {
+		if column := <-ic; column[4] != dataType {
+			t.Errorf("DescribeColumns() = %v; want data type %s", column, dataType)
+		}
+	}
+
+	r := &Retriever{Source: source, ModelName: "orders", Query: "select id, total, note, created from orders order by id"}
+	if err = e.Stream(r, ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(ic)
+	rows := make([][]driver.Value, 0)
+	for row := range ic {
+		rows = append(rows, row)
+	}
+	expected := [][]driver.Value{
+		{"shop", int64(1), 12.5, "first", time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC)},
+		{"shop", int64(2), float64(7), "3", nil},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Stream() = %v; want %v", rows, expected)
+	}
+}
@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnel connects to a source through a bastion host. Preen forwards a local port to the
+// source's host and port over ssh, and the engine connects to the local port instead.
+type SSHTunnel struct {
+	Host string `yaml:"host"`
+	// Port is the ssh port of the bastion, 22 by default
+	Port int    `yaml:"port"`
+	User string `yaml:"user"`
+	// KeyFile is the private key used to authenticate, KeyPassphrase decrypts it if it is encrypted
+	KeyFile       string `yaml:"key_file"`
+	KeyPassphrase string `yaml:"key_passphrase"`
+	// KnownHosts verifies the bastion's host key, ~/.ssh/known_hosts by default
+	KnownHosts string `yaml:"known_hosts"`
+}
+
+// sshTunnelEngines are the engines connecting to a single host and port that can be forwarded.
+var sshTunnelEngines = []string{"postgres", "mysql", "mongodb", "sqlserver", "clickhouse"}
+
+const sshTunnelTimeout = 30 * time.Second
+
+// sshTunnel is an open tunnel, shared by every engine connected to the same source.
+type sshTunnel struct {
+	name     string
+	client   *ssh.Client
+	listener net.Listener
+	refs     int
+}
+
+// sshTunnels are the open tunnels by source name. While a build holds the tunnels, released tunnels stay
+// open so the models retrieved one after the other reuse them.
+var sshTunnels = struct {
+	sync.Mutex
+	open map[string]*sshTunnel
+	held int
+}{open: make(map[string]*sshTunnel)}
+
+// validateSourceSSHTunnels checks the ssh_tunnel block of every source when the config is loaded.
+func validateSourceSSHTunnels(sc *SourceConfig) error {
+	for _, source := range sc.Sources {
+		tunnel := source.SSHTunnel
+		if tunnel == nil {
+			continue
+		}
+		if !slices.Contains(sshTunnelEngines, source.Engine) {
+			return fmt.Errorf("source %s: ssh_tunnel is not supported for %s sources", source.Name, source.Engine)
+		}
+		if tunnel.Host == "" || tunnel.User == "" || tunnel.KeyFile == "" {
+			return fmt.Errorf("source %s: ssh_tunnel host, user and key_file are required", source.Name)
+		}
+	}
+	return nil
+}
+
+// openSSHTunnel returns the source to connect the engine with. Sources with an ssh_tunnel have
+// their host and port replaced by the local end of the tunnel, which is opened on first use.
+// The returned tunnel, nil for sources without one, must be released once the engine is closed.
+func openSSHTunnel(source Source) (Source, *sshTunnel, error) {
+	if source.SSHTunnel == nil {
+		return source, nil, nil
+	}
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+
+	tunnel, ok := sshTunnels.open[source.Name]
+	if !ok {
+		var err error
+		if tunnel, err = dialSSHTunnel(source); err != nil {
+			return source, nil, fmt.Errorf("error opening ssh tunnel for source %s: %w", source.Name, err)
+		}
+		sshTunnels.open[source.Name] = tunnel
+		Debug(fmt.Sprintf("Opened ssh tunnel for %s on %s", source.Name, tunnel.listener.Addr()))
+	}
+	tunnel.refs++
+
+	// Certificates are still verified against the host behind the tunnel
+	if source.Connection.TLS != nil && source.Connection.TLS.ServerName == "" {
+		tlsSettings := *source.Connection.TLS
+		tlsSettings.ServerName = source.Connection.Host
+		source.Connection.TLS = &tlsSettings
+	}
+	addr := tunnel.listener.Addr().(*net.TCPAddr)
+	source.Connection.Host = addr.IP.String()
+	source.Connection.Port = addr.Port
+	return source, tunnel, nil
+}
+
+// release releases the tunnel, closing it once no engine uses it and no build holds the tunnels.
+func (t *sshTunnel) release() {
+	if t == nil {
+		return
+	}
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+
+	t.refs--
+	if t.refs > 0 || (sshTunnels.held > 0 && sshTunnels.open[t.name] == t) {
+		return
+	}
+	t.close()
+}
+
+// close closes the tunnel and removes it from the open tunnels. The caller holds the sshTunnels lock.
+func (t *sshTunnel) close() {
+	if sshTunnels.open[t.name] == t {
+		delete(sshTunnels.open, t.name)
+	}
+	t.listener.Close()
+	if err := t.client.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		Errorf("Error closing ssh tunnel for source %s: %s", t.name, err)
+	}
+	Debug(fmt.Sprintf("Closed ssh tunnel for %s", t.name))
+}
+
+// holdSSHTunnels keeps tunnels open after their engines are closed, until releaseSSHTunnels is called.
+// Builds hold the tunnels so every model and the metadata share one connection to the bastion.
+func holdSSHTunnels() {
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	sshTunnels.held++
+}
+
+// releaseSSHTunnels ends a hold, closing the tunnels no engine uses once no build holds them.
+func releaseSSHTunnels() {
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	sshTunnels.held--
+	if sshTunnels.held > 0 {
+		return
+	}
+	for _, tunnel := range sshTunnels.open {
+		if tunnel.refs == 0 {
+			tunnel.close()
+		}
+	}
+}
+
+// dialSSHTunnel connects to the bastion and starts forwarding a local port to the source.
+func dialSSHTunnel(source Source) (*sshTunnel, error) {
+	config, err := sshClientConfig(source.SSHTunnel)
+	if err != nil {
+		return nil, err
+	}
+	port := source.SSHTunnel.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(source.SSHTunnel.Host, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	tunnel := &sshTunnel{name: source.Name, client: client, listener: listener}
+	remote := net.JoinHostPort(source.Connection.Host, strconv.Itoa(sshTunnelRemotePort(source)))
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go forwardSSHConn(client, conn, remote, source.Name)
+		}
+	}()
+	// A tunnel whose ssh connection dropped is forgotten, so the next engine opens a new one
+	go func() {
+		err := client.Wait()
+		sshTunnels.Lock()
+		defer sshTunnels.Unlock()
+		if sshTunnels.open[source.Name] != tunnel {
+			return
+		}
+		Warn(fmt.Sprintf("SSH tunnel for source %s closed: %v", source.Name, err))
+		delete(sshTunnels.open, source.Name)
+		listener.Close()
+	}()
+	return tunnel, nil
+}
+
+// forwardSSHConn copies a local connection to the remote address and back until either side closes.
+func forwardSSHConn(client *ssh.Client, local net.Conn, remote string, sourceName string) {
+	defer local.Close()
+	remoteConn, err := client.Dial("tcp", remote)
+	if err != nil {
+		Errorf("Error forwarding ssh tunnel for source %s to %s: %s", sourceName, remote, err)
+		return
+	}
+	defer remoteConn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remoteConn, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remoteConn)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func sshClientConfig(tunnel *SSHTunnel) (*ssh.ClientConfig, error) {
+	key, err := os.ReadFile(tunnel.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ssh key_file: %w", err)
+	}
+	var signer ssh.Signer
+	if tunnel.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(tunnel.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ssh key_file: %w", err)
+	}
+
+	knownHostsFile := tunnel.KnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("error finding known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ssh known_hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            tunnel.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshTunnelTimeout,
+	}, nil
+}
+
+// sshTunnelRemotePort returns the source's port, or the engine's default port when it is not set.
+func sshTunnelRemotePort(source Source) int {
+	if source.Connection.Port != 0 {
+		return source.Connection.Port
+	}
+	switch source.Engine {
+	case "mysql":
+		return 3306
+	case "mongodb":
+		return 27017
+	case "sqlserver":
+		return 1433
+	case "clickhouse":
+		if mode := tlsMode(source); mode != "" && mode != "disable" {
+			return clickhouseDefaultTLSPort
+		}
+		return clickhouseDefaultPort
+	default:
+		return 5432
+	}
+}
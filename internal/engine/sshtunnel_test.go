@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer starts an ssh server accepting the client key and forwarding direct-tcpip channels,
+// like a bastion's sshd. It returns the server address and the known_hosts file of its host key.
+func testSSHServer(t *testing.T, clientKey ssh.PublicKey, dir string) (string, string) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "preen" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config)
+		}
+	}()
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, hostSigner.PublicKey())
+	if err = os.WriteFile(knownHostsPath, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return listener.Addr().String(), knownHostsPath
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		// RFC 4254 7.2: host to connect, port to connect, originator address, originator port
+		payload := newChannel.ExtraData()
+		hostLen := binary.BigEndian.Uint32(payload)
+		host := string(payload[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(payload[4+hostLen:])
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			defer channel.Close()
+			defer target.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+// testEchoServer stands in for a database, echoing every line back.
+func testEchoServer(t *testing.T) *net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr)
+}
+
+// testEchoRoundTrip sends a line to the echo server at addr and checks it comes back.
+func testEchoRoundTrip(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("select 1\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "select 1\n" {
+		return fmt.Errorf("read %q through the tunnel", line)
+	}
+	return nil
+}
+
+func TestSSHTunnel(t *testing.T) {
+	Initialize()
+	dir := t.TempDir()
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyBlock, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(keyBlock), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sshAddr, knownHostsPath := testSSHServer(t, sshPublicKey, dir)
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	port, _ := strconv.Atoi(sshPort)
+	database := testEchoServer(t)
+
+	source := Source{
+		Name:       "db",
+		Engine:     "postgres",
+		Connection: Connection{Host: database.IP.String(), Port: database.Port, TLS: &TLS{Mode: "require"}},
+		SSHTunnel:  &SSHTunnel{Host: sshHost, Port: port, User: "preen", KeyFile: keyPath, KnownHosts: knownHostsPath},
+	}
+
+	first, firstTunnel, err := openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, secondTunnel, err := openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Connection.Port == database.Port || first.Connection.Port != second.Connection.Port || firstTunnel != secondTunnel {
+		t.Fatalf("expected a shared local port, got %d and %d", first.Connection.Port, second.Connection.Port)
+	}
+	if first.Connection.TLS.ServerName != database.IP.String() || source.Connection.TLS.ServerName != "" {
+		t.Errorf("expected the tunneled tls server name to be the source host, got %q", first.Connection.TLS.ServerName)
+	}
+
+	addr := net.JoinHostPort(first.Connection.Host, strconv.Itoa(first.Connection.Port))
+	if err = testEchoRoundTrip(addr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The tunnel stays open until every engine has released it
+	firstTunnel.release()
+	if err = testEchoRoundTrip(addr); err != nil {
+		t.Errorf("expected the tunnel to stay open, got %v", err)
+	}
+	secondTunnel.release()
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("expected the tunnel to be closed")
+	}
+
+	// While a build holds the tunnels, released tunnels stay open for the next model
+	holdSSHTunnels()
+	held, tunnel, err := openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tunnel.release()
+	addr = net.JoinHostPort(held.Connection.Host, strconv.Itoa(held.Connection.Port))
+	if err = testEchoRoundTrip(addr); err != nil {
+		t.Errorf("expected the held tunnel to stay open, got %v", err)
+	}
+	reopened, reopenedTunnel, err := openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reopened.Connection.Port != held.Connection.Port {
+		t.Errorf("expected the held tunnel to be reused, got ports %d and %d", held.Connection.Port, reopened.Connection.Port)
+	}
+	reopenedTunnel.release()
+	releaseSSHTunnels()
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("expected the tunnel to be closed after the build")
+	}
+
+	// A tunnel whose ssh connection dropped is replaced by the next engine
+	_, tunnel, err = openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tunnel.client.Close()
+	for i := 0; i < 100 && testSSHTunnelOpen(source.Name) == tunnel; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if testSSHTunnelOpen(source.Name) == tunnel {
+		t.Fatalf("expected the dropped tunnel to be removed")
+	}
+	replaced, replacedTunnel, err := openSSHTunnel(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = testEchoRoundTrip(net.JoinHostPort(replaced.Connection.Host, strconv.Itoa(replaced.Connection.Port))); err != nil {
+		t.Errorf("expected a new tunnel, got %v", err)
+	}
+	// Releasing the dropped tunnel leaves the new one open
+	tunnel.release()
+	if testSSHTunnelOpen(source.Name) != replacedTunnel {
+		t.Errorf("expected the new tunnel to stay open")
+	}
+	replacedTunnel.release()
+
+	// An unknown host key is rejected
+	source.SSHTunnel.KnownHosts = filepath.Join(dir, "empty_known_hosts")
+	if err = os.WriteFile(source.SSHTunnel.KnownHosts, nil, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, tunnel, err = openSSHTunnel(source); err == nil {
+		tunnel.release()
+		t.Errorf("expected host key error, got nil")
+	}
+}
+
+func testSSHTunnelOpen(name string) *sshTunnel {
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	return sshTunnels.open[name]
+}
+
+func TestValidateSourceSSHTunnels(t *testing.T) {
+	tunnel := &SSHTunnel{Host: "bastion.internal", User: "preen", KeyFile: "id_ed25519"}
+
+	tests := []struct {
+		name        string
+		source      Source
+		expectError bool
+	}{
+		{"no tunnel", Source{Engine: "snowflake"}, false},
+		{"tunnel", Source{Engine: "mysql", SSHTunnel: tunnel}, false},
+		{"missing key file", Source{Engine: "postgres", SSHTunnel: &SSHTunnel{Host: "bastion.internal", User: "preen"}}, true},
+		{"unsupported engine", Source{Engine: "s3", SSHTunnel: tunnel}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.source.Name = "db"
+			err := validateSourceSSHTunnels(&SourceConfig{Sources: []Source{tt.source}})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSSHTunnelRemotePort(t *testing.T) {
+	tests := []struct {
+		source   Source
+		expected int
+	}{
+		{Source{Engine: "postgres", Connection: Connection{Port: 6432}}, 6432},
+		{Source{Engine: "mysql"}, 3306},
+		{Source{Engine: "mongodb"}, 27017},
+		{Source{Engine: "sqlserver"}, 1433},
+		{Source{Engine: "clickhouse"}, clickhouseDefaultPort},
+		{Source{Engine: "clickhouse", Connection: Connection{TLS: &TLS{}}}, clickhouseDefaultTLSPort},
+	}
+
+	for _, tt := range tests {
+		if port := sshTunnelRemotePort(tt.source); port != tt.expected {
+			t.Errorf("sshTunnelRemotePort(%s) = %d; want %d", tt.source.Engine, port, tt.expected)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"fmt"
 	"slices"
+	"strings"
 
 	"github.com/preendata/sqlparser"
 )
@@ -13,7 +14,7 @@ type TableSet []TableName
 
 func ParseModelTables(mc *ModelConfig) error {
 	for _, model := range mc.Models {
-		if model.Type == "database" && model.Parsed != nil {
+		if (model.Type == "database" || model.Type == "transform") && model.Parsed != nil {
 			switch stmt := model.Parsed.(type) {
 			case *sqlparser.Select:
 				model.TableMap, model.TableSet = getModelTableAliases(stmt)
@@ -31,19 +32,7 @@ func getModelTableAliases(stmt *sqlparser.Select) (TableMap, TableSet) {
 	table := stmt.From[0]
 	switch t := table.(type) {
 	case *sqlparser.AliasedTableExpr:
-		if t.As.IsEmpty() {
-			tableName := TableName(t.Expr.(sqlparser.TableName).Name.String())
-			tableMap[TableAlias(t.Expr.(sqlparser.TableName).Name.String())] = tableName
-			if !slices.Contains(tableSet, tableName) {
-				tableSet = append(tableSet, tableName)
-			}
-		} else {
-			tableName := TableName(t.Expr.(sqlparser.TableName).Name.String())
-			tableMap[TableAlias(t.As.String())] = tableName
-			if !slices.Contains(tableSet, tableName) {
-				tableSet = append(tableSet, tableName)
-			}
-		}
+		tableSet = addModelTable(t, tableMap, tableSet)
 	case *sqlparser.JoinTableExpr:
 		_, joinTables := parseJoinTables(t, tableMap, tableSet)
 		tableSet = append(tableSet, joinTables...)
@@ -53,37 +42,78 @@ func getModelTableAliases(stmt *sqlparser.Select) (TableMap, TableSet) {
 }
 
 func parseJoinTables(j *sqlparser.JoinTableExpr, tableMap TableMap, tableSet TableSet) (*sqlparser.JoinTableExpr, TableSet) {
-	rightAlias := j.RightExpr.(*sqlparser.AliasedTableExpr).As.String()
-	rightTable := j.RightExpr.(*sqlparser.AliasedTableExpr).Expr.(sqlparser.TableName).Name.String()
-	if rightAlias != "" {
-		tableMap[TableAlias(rightAlias)] = TableName(rightTable)
-		if !slices.Contains(tableSet, TableName(rightTable)) {
-			tableSet = append(tableSet, TableName(rightTable))
-		}
-	} else {
-		tableMap[TableAlias(rightTable)] = TableName(rightTable)
-		if !slices.Contains(tableSet, TableName(rightTable)) {
-			tableSet = append(tableSet, TableName(rightTable))
-		}
-	}
+	tableSet = addModelTable(j.RightExpr.(*sqlparser.AliasedTableExpr), tableMap, tableSet)
 
 	switch left := j.LeftExpr.(type) {
 	case *sqlparser.JoinTableExpr:
 		_, tableSet = parseJoinTables(left, tableMap, tableSet)
 	case *sqlparser.AliasedTableExpr:
-		leftAlias := left.As.String()
-		leftTable := left.Expr.(sqlparser.TableName).Name.String()
-		if leftAlias != "" {
-			tableMap[TableAlias(leftAlias)] = TableName(leftTable)
-			if !slices.Contains(tableSet, TableName(leftTable)) {
-				tableSet = append(tableSet, TableName(leftTable))
-			}
-		} else {
-			tableMap[TableAlias(leftTable)] = TableName(leftTable)
-			if !slices.Contains(tableSet, TableName(leftTable)) {
-				tableSet = append(tableSet, TableName(leftTable))
-			}
-		}
+		tableSet = addModelTable(left, tableMap, tableSet)
 	}
 	return j, tableSet
 }
+
+// addModelTable adds a table of the model query to the table map and set. Schema qualified tables keep their
+// schema, e.g. analytics.orders, and are aliased by their table name unless the query aliases them.
+func addModelTable(t *sqlparser.AliasedTableExpr, tableMap TableMap, tableSet TableSet) TableSet {
+	expr := t.Expr.(sqlparser.TableName)
+	tableName := TableName(expr.Name.String())
+	if !expr.Qualifier.IsEmpty() {
+		tableName = TableName(fmt.Sprintf("%s.%s", expr.Qualifier.String(), expr.Name.String()))
+	}
+	alias := TableAlias(expr.Name.String())
+	if !t.As.IsEmpty() {
+		alias = TableAlias(t.As.String())
+	}
+	tableMap[alias] = tableName
+	if !slices.Contains(tableSet, tableName) {
+		tableSet = append(tableSet, tableName)
+	}
+	return tableSet
+}
+
+// splitTableName returns the schema and table of a model table. The schema is empty for unqualified tables.
+func splitTableName(tableName TableName) (string, string) {
+	if schema, table, ok := strings.Cut(string(tableName), "."); ok {
+		return schema, table
+	}
+	return "", string(tableName)
+}
+
+// tableSetNames returns the model tables a column of schema.table was reported for. Qualified model tables
+// match their own schema, unqualified ones the default schema of the connection. Engines that look tables up
+// by name report each column for every model table it belongs to.
+func tableSetNames(tableSet TableSet, schema string, table string, defaultSchema string) []TableName {
+	tableNames := make([]TableName, 0, 1)
+	for _, tableName := range tableSet {
+		qualifier, name := splitTableName(tableName)
+		if qualifier == "" {
+			qualifier = defaultSchema
+		}
+		if strings.EqualFold(qualifier, schema) && strings.EqualFold(name, table) {
+			tableNames = append(tableNames, tableName)
+		}
+	}
+	return tableNames
+}
+
+// tableSetCondition formats a condition matching the tables of a model's table set for information schema
+// queries. Qualified tables are looked up in their own schema, unqualified tables in defaultSchema, an SQL
+// expression such as schema_name().
+func tableSetCondition(tableSet TableSet, schemaColumn string, tableColumn string, defaultSchema string) string {
+	conditions := make([]string, len(tableSet))
+	for i, tableName := range tableSet {
+		schema, table := splitTableName(tableName)
+		schemaValue := defaultSchema
+		if schema != "" {
+			schemaValue = quoteLiteral(schema)
+		}
+		conditions[i] = fmt.Sprintf("(%s = %s and %s = %s)", schemaColumn, schemaValue, tableColumn, quoteLiteral(table))
+	}
+	return strings.Join(conditions, " or ")
+}
+
+// quoteLiteral formats a string as a quoted SQL literal.
+func quoteLiteral(value string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(value, "'", "''"))
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/preendata/sqlparser"
+)
+
+func TestGetModelTableAliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expectedMap TableMap
+		expectedSet TableSet
+	}{
+		{
+			"unqualified",
+			"select users.id from users",
+			TableMap{"users": "users"},
+			TableSet{"users"},
+		},
+		{
+			"schema qualified",
+			"select orders.id from analytics.orders",
+			TableMap{"orders": "analytics.orders"},
+			TableSet{"analytics.orders"},
+		},
+		{
+			"aliased join across schemas",
+			"select o.id, c.name from analytics.orders o join crm.customers as c on o.customer_id = c.id join users on users.id = c.user_id",
+			TableMap{"o": "analytics.orders", "c": "crm.customers", "users": "users"},
+			TableSet{"users", "crm.customers", "analytics.orders"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := sqlparser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tableMap, tableSet := getModelTableAliases(stmt.(*sqlparser.Select))
+			if !reflect.DeepEqual(tableMap, tt.expectedMap) {
+				t.Errorf("getModelTableAliases() map = %v; want %v", tableMap, tt.expectedMap)
+			}
+			if !reflect.DeepEqual(tableSet, tt.expectedSet) {
+				t.Errorf("getModelTableAliases() set = %v; want %v", tableSet, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestTableSetNames(t *testing.T) {
+	tableSet := TableSet{"analytics.orders", "orders", "customers"}
+	tests := []struct {
+		schema        string
+		table         string
+		defaultSchema string
+		expected      []TableName
+	}{
+		{"analytics", "ORDERS", "shop", []TableName{"analytics.orders"}},
+		{"shop", "orders", "shop", []TableName{"orders"}},
+		{"analytics", "orders", "analytics", []TableName{"analytics.orders", "orders"}},
+		{"other", "orders", "shop", []TableName{}},
+		{"shop", "customers", "shop", []TableName{"customers"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema+"."+tt.table, func(t *testing.T) {
+			if result := tableSetNames(tableSet, tt.schema, tt.table, tt.defaultSchema); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("tableSetNames() = %v; want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTableSetCondition(t *testing.T) {
+	tableSet := TableSet{"analytics.orders", "o'rders", "customers"}
+	expected := "(table_schema = 'analytics' and table_name = 'orders') or " +
+		"(table_schema = schema_name() and table_name = 'o''rders') or " +
+		"(table_schema = schema_name() and table_name = 'customers')"
+	if result := tableSetCondition(tableSet, "table_schema", "table_name", "schema_name()"); result != expected {
+		t.Errorf("tableSetCondition() = %s; want %s", result, expected)
+	}
+}
+
+func TestParseSQLDatabaseModelColumnsQualifiedTables(t *testing.T) {
+	stmt, err := sqlparser.Parse("select o.id, orders.total, sum(o.total) as revenue from analytics.orders o join public.orders on o.id = orders.id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	model := &Model{Name: "orders", Type: "database", Parsed: stmt}
+	model.TableMap, model.TableSet = getModelTableAliases(stmt.(*sqlparser.Select))
+	columnMetadata := ColumnMetadata{
+		"analytics.orders": {"id": {MajorityType: "integer"}, "total": {MajorityType: "numeric"}},
+		"public.orders":    {"id": {MajorityType: "bigint"}, "total": {MajorityType: "text"}},
+	}
+	if err = ParseModelColumns(&ModelConfig{Models: []*Model{model}}, columnMetadata); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "preen_source_name varchar, id integer, total varchar, revenue double"
+	if model.DDLString != expected {
+		t.Errorf("DDLString = %s; want %s", model.DDLString, expected)
+	}
+}
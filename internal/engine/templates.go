@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SourceTemplate expands into one source per inventory entry. Any ${key} placeholder in the
+// template's fields is replaced with the entry's value for key, so the name must contain at
+// least one placeholder to keep the generated source names unique. Placeholders that are not
+// in the inventory are left for environment variable expansion.
+type SourceTemplate struct {
+	Source    `yaml:",inline"`
+	Inventory Inventory `yaml:"inventory"`
+}
+
+// Inventory lists the values a source template is expanded with. Entries are read from either
+// a YAML or CSV file, or from a query against a control source defined in sources.yaml.
+type Inventory struct {
+	File   string `yaml:"file"`
+	Source string `yaml:"source"`
+	Query  string `yaml:"query"`
+}
+
+type inventoryEntry map[string]string
+
+// expandSourceTemplates appends the sources generated from every source template to the source config.
+func expandSourceTemplates(sc *SourceConfig) error {
+	for _, template := range sc.SourceTemplates {
+		entries, err := getInventoryEntries(sc, template.Inventory)
+		if err != nil {
+			return fmt.Errorf("error reading inventory for source template %s: %w", template.Name, err)
+		}
+		Debug(fmt.Sprintf("Expanding source template %s over %d inventory entries", template.Name, len(entries)))
+		for _, entry := range entries {
+			sc.Sources = append(sc.Sources, expandSourceTemplate(template, entry))
+		}
+	}
+	// Templates are fully expanded into sources
+	sc.SourceTemplates = nil
+
+	return errorOnDuplicateSources(sc)
+}
+
+// expandSourceTemplate creates a source from the template with the entry's values substituted.
+func expandSourceTemplate(template SourceTemplate, entry inventoryEntry) Source {
+	source := template.Source
+	source.Models = append([]string{}, template.Models...)
+	expandPlaceholders(reflect.ValueOf(&source).Elem(), entry)
+
+	return source
+}
+
+// expandPlaceholders recursively substitutes inventory values into the string fields of a struct,
+// including the values of string maps.
+func expandPlaceholders(rv reflect.Value, entry inventoryEntry) {
+	for i := 0; i < rv.NumField(); i++ {
+		fv := rv.Field(i)
+		switch fv.Kind() {
+		case reflect.Struct:
+			expandPlaceholders(fv, entry)
+		case reflect.Ptr:
+			// Optional blocks, e.g. tls, are copied so generated sources don't share them
+			if !fv.IsNil() && fv.Elem().Kind() == reflect.Struct {
+				copied := reflect.New(fv.Elem().Type())
+				copied.Elem().Set(fv.Elem())
+				expandPlaceholders(copied.Elem(), entry)
+				fv.Set(copied)
+			}
+		case reflect.String:
+			fv.SetString(expandPlaceholderString(fv.String(), entry))
+		case reflect.Map:
+			// Maps, e.g. connection options, are copied so generated sources don't share them
+			if !fv.IsNil() && fv.Type().Elem().Kind() == reflect.String {
+				copied := reflect.MakeMapWithSize(fv.Type(), fv.Len())
+				iter := fv.MapRange()
+				for iter.Next() {
+					copied.SetMapIndex(iter.Key(), reflect.ValueOf(expandPlaceholderString(iter.Value().String(), entry)).Convert(fv.Type().Elem()))
+				}
+				fv.Set(copied)
+			}
+		case reflect.Slice:
+			for j := 0; j < fv.Len(); j++ {
+				if fv.Index(j).Kind() == reflect.String {
+					fv.Index(j).SetString(expandPlaceholderString(fv.Index(j).String(), entry))
+				}
+			}
+		}
+	}
+}
+
+func expandPlaceholderString(s string, entry inventoryEntry) string {
+	return envRegex.ReplaceAllStringFunc(s, func(match string) string {
+		if value, ok := entry[envRegex.FindStringSubmatch(match)[1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+func getInventoryEntries(sc *SourceConfig, inventory Inventory) ([]inventoryEntry, error) {
+	switch {
+	case inventory.File != "" && inventory.Query != "":
+		return nil, fmt.Errorf("inventory requires either a file or a query, not both")
+	case inventory.File != "":
+		path := inventory.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(sc.Env.PreenConfigPath, path)
+		}
+		return readInventoryFile(path)
+	case inventory.Query != "":
+		return queryInventory(sc, inventory)
+	default:
+		return nil, fmt.Errorf("inventory requires a file or a query")
+	}
+}
+
+// readInventoryFile reads a YAML list of entries, or a CSV file with a header row.
+func readInventoryFile(path string) ([]inventoryEntry, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries := make([]inventoryEntry, 0)
+		if err = yaml.Unmarshal(file, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse inventory file: %w", err)
+		}
+		return entries, nil
+	case ".csv":
+		records, err := csv.NewReader(strings.NewReader(string(file))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse inventory file: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("inventory file %s has no header row", path)
+		}
+		entries := make([]inventoryEntry, 0, len(records)-1)
+		for _, record := range records[1:] {
+			entry := make(inventoryEntry, len(record))
+			for i, value := range record {
+				entry[records[0][i]] = value
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unsupported inventory file format %s", filepath.Ext(path))
+	}
+}
+
+// queryInventory reads the inventory entries from a query against a control source.
+func queryInventory(sc *SourceConfig, inventory Inventory) ([]inventoryEntry, error) {
+	var controlSource *Source
+	for _, source := range sc.Sources {
+		if source.Name == inventory.Source {
+			controlSource = &source
+			break
+		}
+	}
+	if controlSource == nil {
+		return nil, fmt.Errorf("inventory source %s not found in sources", inventory.Source)
+	}
+	// Source templates are expanded before the config is read from the environment and validated,
+	// so the control source is resolved here the way LoadSourceConfig resolves every source
+	fromEnv(controlSource)
+	control := &SourceConfig{Sources: []Source{*controlSource}}
+	if err := applySourceURIs(control); err != nil {
+		return nil, fmt.Errorf("invalid uri config: %w", err)
+	}
+	if err := validateSourceTLS(control); err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+	if err := validateSourceSSHTunnels(control); err != nil {
+		return nil, fmt.Errorf("invalid ssh_tunnel config: %w", err)
+	}
+
+	rows, err := querySource(control.Sources[0], inventory.Query)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]inventoryEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = make(inventoryEntry, len(row))
+		for column, value := range row {
+			switch v := value.(type) {
+			case []byte:
+				entries[i][column] = string(v)
+			default:
+				entries[i][column] = fmt.Sprint(v)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// If two sources share a name, their data could not be told apart in the model tables.
+func errorOnDuplicateSources(sc *SourceConfig) error {
+	sourceNames := make(map[string]bool)
+	for _, source := range sc.Sources {
+		if sourceNames[source.Name] {
+			return fmt.Errorf("duplicate source name: %s", source.Name)
+		}
+		sourceNames[source.Name] = true
+	}
+	return nil
+}
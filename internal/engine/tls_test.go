@@ -0,0 +1,232 @@
+package engine
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a certificate for dnsName, signed by parent, or self signed when parent is nil.
+func testCertificate(t *testing.T, dnsName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		template.DNSNames = []string{dnsName}
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writeCertificate(t *testing.T, dir string, name string, cert tls.Certificate) (string, string) {
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := testCertificate(t, "preen test ca", nil)
+	server := testCertificate(t, "db.internal", &ca)
+	client := testCertificate(t, "preen", &ca)
+	dir := t.TempDir()
+	caPath, _ := writeCertificate(t, dir, "ca", ca)
+	certPath, keyPath := writeCertificate(t, dir, "client", client)
+
+	// The server requires a client certificate signed by the ca
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{server}, ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name           string
+		tls            TLS
+		expectConfig   bool
+		expectDialFail bool
+	}{
+		{"verify-full", TLS{CAFile: caPath, CertFile: certPath, KeyFile: keyPath, ServerName: "db.internal"}, true, false},
+		{"verify-full wrong host", TLS{CAFile: caPath, CertFile: certPath, KeyFile: keyPath}, true, true},
+		{"verify-full unknown ca", TLS{CertFile: certPath, KeyFile: keyPath, ServerName: "db.internal"}, true, true},
+		{"verify-ca wrong host", TLS{Mode: "verify-ca", CAFile: caPath, CertFile: certPath, KeyFile: keyPath}, true, false},
+		{"require", TLS{Mode: "require", CertFile: certPath, KeyFile: keyPath}, true, false},
+		{"disable", TLS{Mode: "disable"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := Source{Connection: Connection{Host: "127.0.0.1", TLS: &tt.tls}}
+			config, err := tlsConfig(source)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (config != nil) != tt.expectConfig {
+				t.Fatalf("tlsConfig() = %v; want config %v", config, tt.expectConfig)
+			}
+			if config == nil {
+				return
+			}
+			conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+			if err == nil {
+				conn.Close()
+			}
+			if tt.expectDialFail && err == nil {
+				t.Errorf("expected handshake error, got nil")
+			}
+			if !tt.expectDialFail && err != nil {
+				t.Errorf("unexpected handshake error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSourceTLS(t *testing.T) {
+	dir := t.TempDir()
+	caPath, _ := writeCertificate(t, dir, "ca", testCertificate(t, "preen test ca", nil))
+
+	tests := []struct {
+		name        string
+		source      Source
+		expectError bool
+	}{
+		{"no tls", Source{Engine: "s3"}, false},
+		{"verify-full", Source{Engine: "postgres", Connection: Connection{TLS: &TLS{CAFile: caPath}}}, false},
+		{"disable", Source{Engine: "mysql", Connection: Connection{TLS: &TLS{Mode: "disable"}}}, false},
+		{"invalid mode", Source{Engine: "postgres", Connection: Connection{TLS: &TLS{Mode: "prefer"}}}, true},
+		{"cert without key", Source{Engine: "mongodb", Connection: Connection{TLS: &TLS{CertFile: caPath}}}, true},
+		{"missing ca file", Source{Engine: "sqlserver", Connection: Connection{TLS: &TLS{CAFile: filepath.Join(dir, "missing.crt")}}}, true},
+		{"unsupported engine", Source{Engine: "snowflake", Connection: Connection{TLS: &TLS{}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.source.Name = "db"
+			err := validateSourceTLS(&SourceConfig{Sources: []Source{tt.source}})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSourceTLSDriverConfig(t *testing.T) {
+	source := Source{Name: "db", Connection: Connection{Host: "db.internal", Port: 5432, Database: "shop", Username: "preen", TLS: &TLS{Mode: "require"}}}
+
+	pgConfig, err := postgresConfig(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pgConfig.ConnConfig.TLSConfig == nil || !pgConfig.ConnConfig.TLSConfig.InsecureSkipVerify || len(pgConfig.ConnConfig.Fallbacks) != 0 {
+		t.Errorf("postgresConfig() did not apply the tls block")
+	}
+
+	dsn, err := mysqlDSN(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "preen:@tcp(db.internal:5432)/shop?parseTime=true&tls=preen-db"; dsn != expected {
+		t.Errorf("mysqlDSN() = %s; want %s", dsn, expected)
+	}
+
+	sqlserverConf, err := sqlserverConfig(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sqlserverConf.TLSConfig == nil || !sqlserverConf.TLSConfig.InsecureSkipVerify {
+		t.Errorf("sqlserverConfig() did not apply the tls block")
+	}
+
+	source.Connection.Port = 0
+	if endpoint, _ := clickhouseEndpoint(source); endpoint != "https://db.internal:8443/?database=shop&date_time_output_format=iso" {
+		t.Errorf("clickhouseEndpoint() = %s", endpoint)
+	}
+
+	source.Connection.Port = 5432
+	source.Connection.TLS.Mode = "disable"
+	if pgConfig, err = postgresConfig(source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pgConfig.ConnConfig.TLSConfig != nil {
+		t.Errorf("postgresConfig() kept tls for mode disable")
+	}
+}
+
+func TestBinlogSyncerConfig(t *testing.T) {
+	source := Source{
+		Name:   "shop-db",
+		Engine: "mysql",
+		Connection: Connection{
+			Host: "db.internal", Port: 3307, Username: "preen", Password: "secret", Database: "shop",
+			TLS: &TLS{Mode: "require"},
+		},
+	}
+	config, err := binlogSyncerConfig(source, 4242)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "db.internal" || config.Port != 3307 || config.User != "preen" || config.Password != "secret" || config.ServerID != 4242 {
+		t.Errorf("binlogSyncerConfig() = %+v", config)
+	}
+	if config.TLSConfig == nil || config.TLSConfig.ServerName != "db.internal" {
+		t.Errorf("binlogSyncerConfig() did not apply the source tls settings")
+	}
+
+	// Unix sockets are dialed by path
+	source.Connection = Connection{URI: "preen:secret@unix(/var/run/mysqld/mysqld.sock)/shop"}
+	if config, err = binlogSyncerConfig(source, 4242); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "/var/run/mysqld/mysqld.sock" || config.Port != 0 || config.TLSConfig != nil {
+		t.Errorf("binlogSyncerConfig() = %+v", config)
+	}
+}
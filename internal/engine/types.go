@@ -66,6 +66,7 @@ func (d duckdbDecimal) Value() (driver.Value, error) {
 
 // duckdbTime is a custom type for scanning and valuing time.Time values.
 // The PG driver returns time types as a custom type, so we need to convert them to string.
+// The SQL Server driver returns time types as time.Time.
 // The database/sql driver doesn't respect time data types.
 type duckdbTime string
 
@@ -77,6 +78,9 @@ func (t *duckdbTime) Scan(s any) error {
 		midnight := time.Now().Truncate(24 * time.Hour)
 		resultTime := midnight.Add(time.Duration(timeType.Microseconds) * time.Microsecond)
 		*t = duckdbTime(resultTime.String())
+	// The time.Time type is from the SQL Server driver, its date is 0001-01-01.
+	case time.Time:
+		*t = duckdbTime(v.Format("15:04:05.9999999"))
 	case nil:
 		*t = duckdbTime("")
 	default:
@@ -199,6 +203,7 @@ func (u duckdbUUID) Value() (driver.Value, error) {
 var duckdbTypeMap = map[string]string{
 	"integer":                     "integer",
 	"bigint":                      "bigint",
+	"ubigint":                     "ubigint",
 	"smallint":                    "smallint",
 	"mediumint":                   "integer",
 	"int":                         "integer",
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// uriEngines are the engines that connect with a connection string, and so take a uri or options.
+var uriEngines = []string{"postgres", "mysql", "mongodb", "sqlserver", "clickhouse", "snowflake", "sqlite"}
+
+// applySourceURIs checks the uri and options of every source. Engines query the tables of their
+// database, so the database and schema named by a uri replace the database and schema fields.
+func applySourceURIs(sc *SourceConfig) error {
+	for i := range sc.Sources {
+		source := &sc.Sources[i]
+		connection := &source.Connection
+		if connection.URI == "" && len(connection.Options) == 0 {
+			continue
+		}
+		if !slices.Contains(uriEngines, source.Engine) {
+			return fmt.Errorf("source %s: uri and options are not supported for %s sources", source.Name, source.Engine)
+		}
+		if connection.URI == "" {
+			continue
+		}
+		if len(connection.Options) > 0 {
+			return fmt.Errorf("source %s: options only apply to generated connection strings, add them to the uri instead", source.Name)
+		}
+		if source.SSHTunnel != nil {
+			return fmt.Errorf("source %s: ssh_tunnel can not be combined with uri", source.Name)
+		}
+		database, schema, err := uriDatabase(source.Engine, connection.URI)
+		if err != nil {
+			return fmt.Errorf("source %s: invalid uri: %w", source.Name, err)
+		}
+		if database != "" {
+			connection.Database = database
+		}
+		if schema != "" {
+			connection.Schema = schema
+		}
+	}
+	return nil
+}
+
+// uriDatabase returns the database, and the schema of snowflake sources, named by a connection string.
+// Connection strings are parsed without any network lookups, e.g. of mongodb+srv records.
+func uriDatabase(engine string, uri string) (string, string, error) {
+	switch engine {
+	case "postgres":
+		config, err := pgconn.ParseConfig(uri)
+		if err != nil {
+			return "", "", err
+		}
+		return config.Database, "", nil
+	case "mysql":
+		config, err := mysql.ParseDSN(uri)
+		if err != nil {
+			return "", "", err
+		}
+		return config.DBName, "", nil
+	case "mongodb":
+		database, err := mongoURIDatabase(uri)
+		return database, "", err
+	case "sqlserver":
+		config, err := msdsn.Parse(uri)
+		if err != nil {
+			return "", "", err
+		}
+		return config.Database, "", nil
+	case "clickhouse":
+		u, err := url.Parse(uri)
+		if err != nil {
+			return "", "", err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", "", fmt.Errorf("clickhouse uri must be an http or https url")
+		}
+		return u.Query().Get("database"), "", nil
+	case "snowflake":
+		config, err := gosnowflake.ParseDSN(uri)
+		if err != nil {
+			return "", "", err
+		}
+		return config.Database, config.Schema, nil
+	case "sqlite":
+		_, err := sqliteDSN(Source{Connection: Connection{URI: uri}})
+		return "", "", err
+	default:
+		return "", "", nil
+	}
+}
+
+// mongoURIDatabase reads the database from the path of a mongodb:// or mongodb+srv:// uri. Hosts of
+// replica sets are comma separated, which url.Parse rejects.
+func mongoURIDatabase(uri string) (string, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || (scheme != "mongodb" && scheme != "mongodb+srv") {
+		return "", fmt.Errorf("mongodb uri must start with mongodb:// or mongodb+srv://")
+	}
+	_, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", nil
+	}
+	path, _, _ = strings.Cut(path, "?")
+	return url.PathUnescape(path)
+}
+
+// connectionOptions returns a source's options as url parameters. Encode sorts them, so generated
+// connection strings are stable.
+func connectionOptions(source Source) url.Values {
+	values := url.Values{}
+	for key, value := range source.Connection.Options {
+		values.Set(key, value)
+	}
+	return values
+}